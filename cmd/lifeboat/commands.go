@@ -0,0 +1,1804 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kannan/tts-lifeboat/internal/backup"
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+	"github.com/kannan/tts-lifeboat/internal/tomcat"
+)
+
+// runCommand handles the non-menu invocations (`lifeboat <command> ...`).
+// Returns the process exit code.
+func runCommand(cfg *config.Config, args []string) int {
+	switch args[0] {
+	case "browse":
+		return cmdBrowse(cfg, args[1:])
+	case "inspect":
+		return cmdInspect(cfg, args[1:])
+	case "manifest":
+		return cmdManifest(cfg, args[1:])
+	case "replicate":
+		return cmdReplicate(cfg, args[1:])
+	case "sync":
+		return cmdSync(cfg, args[1:])
+	case "history":
+		return cmdHistory(cfg, args[1:])
+	case "backup":
+		return cmdBackup(cfg, args[1:])
+	case "cleanup":
+		return cmdCleanup(cfg, args[1:])
+	case "logs":
+		return cmdLogs(cfg, args[1:])
+	case "note":
+		return cmdNote(cfg, args[1:])
+	case "tag":
+		return cmdTag(cfg, args[1:])
+	case "delete":
+		return cmdDelete(cfg, args[1:])
+	case "extend":
+		return cmdExtend(cfg, args[1:])
+	case "stats":
+		return cmdStats(cfg, args[1:])
+	case "search":
+		return cmdSearch(cfg, args[1:])
+	case "info":
+		return cmdInfo(cfg, args[1:])
+	case "export":
+		return cmdExport(cfg, args[1:])
+	case "import":
+		return cmdImport(cfg, args[1:])
+	case "health":
+		return cmdHealth(cfg, args[1:])
+	case "drift":
+		return cmdDrift(cfg, args[1:])
+	case "catalog":
+		return cmdCatalog(cfg, args[1:])
+	default:
+		return fail(fmt.Errorf("unknown command %q", args[0]))
+	}
+}
+
+// cmdBrowse: lifeboat browse <id> [--item NAME] [--match GLOB] [--json]
+// Lists the files inside a backup without extracting anything.
+func cmdBrowse(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("browse", flag.ContinueOnError)
+	item := fs.String("item", "", "only list files of this webapp/folder")
+	match := fs.String("match", "", "only list files whose name or path matches this glob, e.g. *.xml")
+	asJSON := fs.Bool("json", session.json, "print JSON instead of a table")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return 1
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	all, err := backup.List(e)
+	if err != nil {
+		return fail(err)
+	}
+	files := all[:0]
+	for _, f := range all {
+		if *item != "" && f.Path != *item && !strings.HasPrefix(f.Path, *item+"/") {
+			continue
+		}
+		if *match != "" && !globMatch(*match, f.Path) {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(files); err != nil {
+			return 1
+		}
+		return 0
+	}
+	var total int64
+	for _, f := range files {
+		name := f.Path
+		if f.Link != "" {
+			name += " -> " + f.Link
+		}
+		fmt.Printf("  %-16s  %-8s  %s\n", f.ModTime.Format("2006-01-02 15:04"), backup.HumanSize(f.Size), name)
+		total += f.Size
+	}
+	fmt.Printf("\n%d file(s), %s in %s\n", len(files), backup.HumanSize(total), backup.ID(cfg, e))
+	return 0
+}
+
+// globMatch matches pattern against the whole slash path or its last element.
+func globMatch(pattern, p string) bool {
+	if ok, _ := path.Match(pattern, p); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(p))
+	return ok
+}
+
+// cmdInspect: lifeboat inspect <id> --peek <item>/<path> [--hex]
+func cmdInspect(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	peek := fs.String("peek", "", "file to print, e.g. MyApp/WEB-INF/web.xml")
+	forceHex := fs.Bool("hex", false, "always print as a hexdump")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return 1
+	}
+	if *peek == "" {
+		fmt.Fprintln(os.Stderr, "usage: lifeboat inspect <id> --peek <item>/<path> [--hex]")
+		return 1
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	var buf bytes.Buffer
+	if err := backup.Peek(e, *peek, &buf); err != nil {
+		return fail(err)
+	}
+	if *forceHex || isBinary(buf.Bytes()) {
+		d := hex.Dumper(os.Stdout)
+		_, _ = d.Write(buf.Bytes())
+		_ = d.Close()
+		return 0
+	}
+	_, _ = os.Stdout.Write(buf.Bytes())
+	return 0
+}
+
+// cmdManifest: lifeboat manifest <id> [--json]
+// Dumps the per-file listing recorded when the backup was made.
+func cmdManifest(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	asJSON := fs.Bool("json", session.json, "print the raw manifest as JSON")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return 1
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	m, err := backup.ReadManifest(e)
+	if err != nil {
+		return fail(fmt.Errorf("no manifest for %s - %w", backup.ID(cfg, e), err))
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(m); err != nil {
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("Backup %s of %s on %s (lifeboat %s)\n", backup.ID(cfg, e), m.Name, m.Host, m.Version)
+	if m.Consistency != "" {
+		fmt.Printf("Captured %s over %s, %s\n", m.Created.Format("2006-01-02 15:04:05"),
+			m.Finished.Sub(m.Created).Round(time.Second), m.Consistency)
+	}
+	if m.Note != "" {
+		fmt.Println("Note:", m.Note)
+	}
+	fmt.Println()
+	for _, f := range m.Files {
+		sum := f.SHA256
+		if len(sum) > 12 {
+			sum = sum[:12]
+		}
+		name := f.Path
+		if f.Link != "" {
+			name += " -> " + f.Link
+		}
+		fmt.Printf("  %-12s  %-8s  %s\n", sum, backup.HumanSize(f.Size), name)
+	}
+	fmt.Printf("\n%d file(s)\n", len(m.Files))
+	return 0
+}
+
+// cmdReplicate: lifeboat replicate <id>
+// Copies one backup to replica_path again, replacing any existing copy.
+func cmdReplicate(cfg *config.Config, args []string) int {
+	if cfg.ReadOnly {
+		return fail(errReadOnly)
+	}
+	fs := flag.NewFlagSet("replicate", flag.ContinueOnError)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return 1
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	release, err := lockBackupPath(cfg, "replicate")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	ctx, done := cancellable()
+	defer done()
+	n, err := backup.Replicate(ctx, cfg, e)
+	if err != nil {
+		return fail(err)
+	}
+	if session.json {
+		return printJSON(struct {
+			ID      string `json:"id"`
+			Replica string `json:"replica"`
+			Bytes   int64  `json:"bytes"`
+		}{backup.ID(cfg, e), backup.ReplicaPath(cfg, e), n})
+	}
+	fmt.Printf("Replicated %s to %s (%s)\n", backup.ID(cfg, e), backup.ReplicaPath(cfg, e), backup.HumanSize(n))
+	return 0
+}
+
+// cmdSync: lifeboat sync [--pull] [--dry-run]
+// Makes backup_path and replica_path converge: copies every backup missing
+// from the replica, and reports (or with --pull copies back) backups that
+// only exist in the replica.
+func cmdSync(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	pull := fs.Bool("pull", false, "also copy replica-only backups back into backup_path")
+	dryRun := fs.Bool("dry-run", false, "only report what is out of sync")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if cfg.ReadOnly && !*dryRun {
+		return fail(fmt.Errorf("%w (use --dry-run)", errReadOnly))
+	}
+	pending, err := backup.Pending(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	remoteOnly, err := backup.ReplicaOnly(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	ids := func(es []backup.HistoryEntry) []string {
+		out := make([]string, 0, len(es))
+		for _, e := range es {
+			out = append(out, backup.ID(cfg, e))
+		}
+		return out
+	}
+	res := struct {
+		DryRun      bool     `json:"dry_run"`
+		Missing     []string `json:"missing_in_replica"`
+		ReplicaOnly []string `json:"only_in_replica"`
+		Pushed      int      `json:"pushed"`
+		Pulled      int      `json:"pulled"`
+	}{DryRun: *dryRun, Missing: ids(pending), ReplicaOnly: ids(remoteOnly)}
+	say := func(format string, a ...any) {
+		if !session.json {
+			fmt.Printf(format, a...)
+		}
+	}
+	if *dryRun {
+		for _, id := range res.Missing {
+			say("  missing in replica:  %s\n", id)
+		}
+		for _, id := range res.ReplicaOnly {
+			say("  only in replica:     %s\n", id)
+		}
+		say("%d to push, %d only in replica.\n", len(pending), len(remoteOnly))
+		if session.json {
+			return printJSON(res)
+		}
+		return 0
+	}
+
+	release, err := lockBackupPath(cfg, "sync")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	ctx, done := cancellable()
+	defer done()
+	n, err := backup.Flush(ctx, cfg, func(e backup.HistoryEntry) {
+		say("Replicating %s ...\n", backup.ID(cfg, e))
+	})
+	if err != nil {
+		return fail(err)
+	}
+	res.Pushed = n
+	say("%d backup(s) pushed to %s.\n", n, cfg.ReplicaPath)
+
+	if !*pull {
+		for _, id := range res.ReplicaOnly {
+			say("  only in replica: %s (use --pull to copy it back)\n", id)
+		}
+	} else {
+		for _, e := range remoteOnly {
+			say("Pulling %s ...\n", backup.ID(cfg, e))
+			if _, err := backup.Pull(ctx, cfg, e); err != nil {
+				return fail(err)
+			}
+			res.Pulled++
+		}
+		say("%d backup(s) pulled from %s.\n", len(remoteOnly), cfg.ReplicaPath)
+	}
+	if session.json {
+		return printJSON(res)
+	}
+	return 0
+}
+
+// Exit codes of `lifeboat <command>`, so a scheduled task or CI job can
+// tell a warning-level run from a hard failure.
+const (
+	exitOK       = 0
+	exitFailed   = 1
+	exitWarnings = 2 // completed, but errors were logged (missing extra folder, replica unreachable, ...)
+	exitConfig   = 3 // lifeboat.toml missing or invalid
+	exitNoMatch  = 4 // search found no backup
+)
+
+var errReadOnly = errors.New("not available in read-only mode")
+
+// fail reports err and returns exitFailed.
+func fail(err error) int {
+	printError(err.Error())
+	return exitFailed
+}
+
+// printError writes an error as "ERROR: ..." on stderr, or with
+// --output json as {"error": "..."} on stdout so scripts get one document.
+func printError(msg string) {
+	if session.json {
+		_ = printJSON(struct {
+			Error string `json:"error"`
+		}{msg})
+		return
+	}
+	fmt.Fprintln(os.Stderr, "ERROR:", msg)
+}
+
+// parseWithID parses flags that may appear before or after a single
+// positional backup ID and returns that ID.
+func parseWithID(fs *flag.FlagSet, args []string) (string, error) {
+	var id string
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		id, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if id == "" && fs.NArg() > 0 {
+		id = fs.Arg(0)
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return "", err
+		}
+	}
+	if id == "" {
+		printError(fmt.Sprintf("%s needs a backup ID (e.g. 20260421-2126 or latest)", fs.Name()))
+		return "", fmt.Errorf("missing id")
+	}
+	return id, nil
+}
+
+// isBinary guesses whether b should be hexdumped rather than printed.
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b)
+}
+
+// cmdBackup: lifeboat backup [--items A,B] [--stdout]
+// Backs up the webapps (all unless --items) plus extra_folders without any
+// prompt, the way menu option 1 does. With --stdout it streams one
+// .tar.zst to stdout instead; progress and errors go to stderr.
+func cmdBackup(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	toStdout := fs.Bool("stdout", false, "stream one .tar.zst archive to standard output")
+	names := fs.String("items", "", "comma-separated webapps to include (default: all)")
+	note := fs.String("note", "", "note stored with the backup, e.g. \"before release 4.2\"")
+	verify := fs.Bool("verify", false, "re-read the new backup and check it against its manifest")
+	dryRun := fs.Bool("dry-run", false, "only show what would be backed up and how big it would be")
+	if err := fs.Parse(args); err != nil {
+		return exitFailed
+	}
+	if cfg.ReadOnly && !*dryRun {
+		return fail(errReadOnly)
+	}
+	if *toStdout {
+		if isTerminal(os.Stdout) {
+			return fail(errors.New("refusing to write an archive to the terminal; pipe or redirect stdout"))
+		}
+	}
+	items, err := backup.ListWebapps(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	if *names != "" {
+		if items, err = pickItems(items, *names); err != nil {
+			return fail(err)
+		}
+	}
+	if *dryRun {
+		return backupDryRun(cfg, items)
+	}
+	if *toStdout {
+		return backupStream(cfg, items, *note)
+	}
+
+	errorsBefore := logger.Errors()
+	if err := backup.BudgetPreflight(cfg); err != nil {
+		return exitFailed
+	}
+	if len(items) == 0 {
+		return fail(fmt.Errorf("no items found in %s", cfg.WebappsPath))
+	}
+	release, err := lockBackupPath(cfg, "backup")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	status("Backing up %d items (compression=%v)...\n", len(items), cfg.Compression)
+	var dest string
+	var n int64
+	var start time.Time
+	delay := time.Duration(cfg.RetryDelayMinutes) * time.Minute
+	for attempt := 1; ; attempt++ {
+		start = time.Now()
+		dest, n, err = backupOnce(cfg, items, *note)
+		if err == nil || errors.Is(err, context.Canceled) || attempt > cfg.RetryCount {
+			break
+		}
+		logger.Info("backup attempt %d of %d failed, retrying in %s: %v", attempt, cfg.RetryCount+1, delay, err)
+		status("Attempt %d of %d failed: %v\nRetrying in %s ...\n", attempt, cfg.RetryCount+1, err, delay)
+		if !sleep(delay) {
+			err = context.Canceled
+			break
+		}
+		if delay *= 2; delay > time.Hour {
+			delay = time.Hour
+		}
+	}
+	var took time.Duration
+	if err == nil {
+		took = time.Since(start).Round(time.Millisecond)
+		status("Backup complete: %s, %s in %s\n", dest, backup.HumanSize(n), took)
+		// A backup that does not verify is recorded and notified as failed.
+		if *verify {
+			var files int
+			if files, err = backup.Verify(backup.HistoryEntry{Path: dest}); err == nil {
+				status("Verified %d file(s) against the manifest.\n", files)
+			}
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		backup.RecordResult(cfg, dest, err)
+	}
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			notifyDone(cfg, "Backup FAILED", err.Error())
+		}
+		return fail(err)
+	}
+	if cfg.ReplicaPath != "" {
+		replicateAfterBackup(cfg)
+	}
+	cleanupAfterBackup(cfg)
+	backup.CheckBudget(cfg)
+
+	code := exitOK
+	if logger.Errors() > errorsBefore {
+		code = exitWarnings
+	}
+	if session.json {
+		_ = printJSON(struct {
+			Path     string  `json:"path"`
+			Bytes    int64   `json:"bytes"`
+			Seconds  float64 `json:"seconds"`
+			Verified bool    `json:"verified"`
+			Warnings bool    `json:"warnings"`
+		}{dest, n, took.Seconds(), *verify, code == exitWarnings})
+	}
+	return code
+}
+
+// lockWaitPoll is how often --wait tries the run lock again.
+const lockWaitPoll = 5 * time.Second
+
+// lockBackupPath takes backup_path's run lock for a command that writes to
+// or deletes from it; a refusal is logged for unattended runs. With --wait
+// it queues until the lock is free or the user interrupts.
+func lockBackupPath(cfg *config.Config, command string) (func(), error) {
+	release, err := backup.AcquireRunLock(cfg, command)
+	var locked *backup.LockedError
+	if session.wait && errors.As(err, &locked) {
+		logger.Info("%s waiting: %v", command, err)
+		status("Waiting for the lifeboat %s running on %s (pid %d) to finish ...\n", locked.Holder.Command, locked.Holder.Host, locked.Holder.PID)
+		for errors.As(err, &locked) {
+			if !sleep(lockWaitPoll) {
+				err = context.Canceled
+				break
+			}
+			release, err = backup.AcquireRunLock(cfg, command)
+		}
+	}
+	if err != nil {
+		logger.Info("%s not started: %v", command, err)
+	}
+	return release, err
+}
+
+// backupStream is cmdBackup --stdout: the archive goes to stdout, every
+// message to stderr. Tomcat is stopped around it as for any backup.
+func backupStream(cfg *config.Config, items []backup.Item, note string) int {
+	session.stdoutData = true
+	if err := backup.BudgetPreflight(cfg); err != nil {
+		return exitFailed
+	}
+	release, err := lockBackupPath(cfg, "backup")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	if cfg.StopTomcat && !stopTomcatFor(cfg) {
+		return fail(errors.New("tomcat did not stop, backup not started"))
+	}
+	ctx, done := cancellable()
+	res, err := backup.Stream(backup.WithNote(ctx, note), cfg, items, os.Stdout, func(step, total int, name string) {
+		status("  [%d/%d] %s\n", step, total, name)
+	})
+	done()
+	if cfg.StopTomcat {
+		startTomcatAfter(cfg)
+	}
+	if !errors.Is(err, context.Canceled) {
+		backup.RecordStreamResult(cfg, res.ID, err)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	status("Streamed %s, sha256 %s\n", backup.HumanSize(res.Bytes), res.SHA256)
+	if res.Manifest != "" {
+		status("Manifest: %s\n", res.Manifest)
+	}
+	return exitOK
+}
+
+// backupOnce is one attempt of cmdBackup, with Tomcat stopped around it
+// when stop_tomcat is set.
+func backupOnce(cfg *config.Config, items []backup.Item, note string) (string, int64, error) {
+	if cfg.StopTomcat && !stopTomcatFor(cfg) {
+		return "", 0, errors.New("tomcat did not stop, backup not started")
+	}
+	ctx, done := cancellable()
+	dest, n, err := backup.Run(backup.WithNote(ctx, note), cfg, items, func(step, total int, name string) {
+		status("  [%d/%d] %s\n", step, total, name)
+	})
+	done()
+	if cfg.StopTomcat {
+		startTomcatAfter(cfg)
+	}
+	return dest, n, err
+}
+
+// sleep waits for d unless Ctrl+C comes first; it reports whether the
+// whole wait passed.
+func sleep(d time.Duration) bool {
+	ctx, done := cancellable()
+	defer done()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// backupDryRun prints what cmdBackup would copy for items, with the size
+// the backup is likely to take judging by earlier ones.
+func backupDryRun(cfg *config.Config, items []backup.Item) int {
+	plan, err := backup.PlanBackup(cfg, items)
+	if err != nil {
+		return fail(err)
+	}
+	if session.json {
+		return printJSON(plan)
+	}
+	fmt.Printf("Would back up to %s:\n\n", filepath.Join(cfg.BackupPath, "YYYYMMDD", "HHMM"))
+	for _, it := range plan.Items {
+		switch {
+		case it.Missing:
+			fmt.Printf("  %-30s  missing, would be skipped\n", it.Name)
+		case it.Kind == backup.PlanDump:
+			fmt.Printf("  %-30s  size known after the dump\n", it.Output)
+		default:
+			fmt.Printf("  %-30s  %6d file(s)  %s\n", it.Output, it.Files, backup.HumanSize(it.Bytes))
+		}
+	}
+	fmt.Printf("\n%d file(s), %s to read", plan.Files, backup.HumanSize(plan.Bytes))
+	switch {
+	case plan.Projected > 0 && plan.Ratio > 0 && cfg.Compression:
+		fmt.Printf(", about %s on disk (past backups stored %.0f%% of original size)", backup.HumanSize(plan.Projected), plan.Ratio*100)
+	case plan.Projected > 0:
+		fmt.Printf(", %s on disk", backup.HumanSize(plan.Projected))
+	default:
+		fmt.Print(", size on disk unknown until the first compressed backup")
+	}
+	fmt.Println()
+	return exitOK
+}
+
+// cmdCleanup: lifeboat cleanup [--dry-run]
+// Deletes the expired backups like menu option 3. Without a terminal to
+// ask on, it only deletes when --yes says so or confirmation = "off".
+func cmdCleanup(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only list what would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return exitFailed
+	}
+	if cfg.ReadOnly && !*dryRun {
+		return fail(fmt.Errorf("%w (use --dry-run)", errReadOnly))
+	}
+	res := struct {
+		DryRun  bool     `json:"dry_run"`
+		Expired []string `json:"expired"`
+		Deleted int      `json:"deleted"`
+		Freed   int64    `json:"freed_bytes"`
+	}{DryRun: *dryRun, Expired: []string{}}
+	if !cfg.CleanupEnabled() {
+		status("Retention disabled (retention_days = 0).\n")
+		if session.json {
+			return printJSON(res)
+		}
+		return exitOK
+	}
+	preview, freed, err := backup.Cleanup(cfg, true)
+	if err != nil {
+		return fail(err)
+	}
+	for _, e := range preview {
+		res.Expired = append(res.Expired, backup.ID(cfg, e))
+		status("  expired: %s  %-8s  %s\n", backup.ID(cfg, e), backup.HumanSize(e.Size), e.Path)
+	}
+	res.Freed = freed
+	if *dryRun || len(preview) == 0 {
+		status("%d backup(s) expired (%s).\n", len(preview), retentionRule(cfg))
+		if session.json {
+			return printJSON(res)
+		}
+		return exitOK
+	}
+
+	if !session.yes && cfg.Confirmation != "off" {
+		if !isTerminal(os.Stdin) {
+			return fail(errors.New("cleanup needs --yes when nobody is there to confirm"))
+		}
+		reader := bufio.NewReader(os.Stdin)
+		if !confirm(cfg, reader, "Delete these backups?", "DELETE") {
+			status("Cancelled.\n")
+			return exitFailed
+		}
+		if !ensureOperator(cfg, reader) {
+			return exitFailed
+		}
+	}
+	if cfg.RequireOperator && session.operator == "" {
+		return fail(errors.New("require_operator is set; pass --operator"))
+	}
+	release, err := lockBackupPath(cfg, "cleanup")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	errorsBefore := logger.Errors()
+	pruneLog(cfg)
+	logger.Info("cleanup confirmed %s", actor())
+	deleted, freed, err := backup.Cleanup(cfg, false)
+	if err != nil {
+		return fail(err)
+	}
+	res.Deleted, res.Freed = len(deleted), freed
+	status("Deleted %d backup(s), freed %s.\n", len(deleted), backup.HumanSize(freed))
+	code := exitOK
+	if logger.Errors() > errorsBefore {
+		code = exitWarnings
+	}
+	if session.json {
+		_ = printJSON(res)
+	}
+	return code
+}
+
+// cmdExtend: lifeboat extend <id> --days N
+// Keeps one backup N days longer than the retention rules would.
+func cmdExtend(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("extend", flag.ContinueOnError)
+	days := fs.Int("days", 30, "days to add to the backup's expiry")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return exitFailed
+	}
+	if cfg.ReadOnly {
+		return fail(errReadOnly)
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	release, err := lockBackupPath(cfg, "extend")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	until, err := backup.Extend(cfg, e, *days)
+	if err != nil {
+		return fail(err)
+	}
+	if session.json {
+		return printJSON(struct {
+			ID        string `json:"id"`
+			KeepUntil string `json:"keep_until"`
+		}{backup.ID(cfg, e), until.Format("2006-01-02")})
+	}
+	fmt.Printf("%s is kept until %s (%s)\n", backup.ID(cfg, e), until.Format("2006-01-02"), until.Format("Mon 02 Jan 2006"))
+	return exitOK
+}
+
+// cmdDelete: lifeboat delete <id>... [--force]
+// Deletes the given backups from backup_path, whatever the retention rules
+// say. Copies in replica_path are left alone, like cleanup does.
+func cmdDelete(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	force := fs.Bool("force", false, "do not ask for confirmation")
+	var ids []string
+	for rest := args; ; {
+		if err := fs.Parse(rest); err != nil {
+			return exitFailed
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		ids, rest = append(ids, fs.Arg(0)), fs.Args()[1:]
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: lifeboat delete <id>... [--force]")
+		return exitFailed
+	}
+	if cfg.ReadOnly {
+		return fail(errReadOnly)
+	}
+	var targets []backup.HistoryEntry
+	seen := map[string]bool{}
+	for _, id := range ids {
+		e, err := backup.Find(cfg, id)
+		if err != nil {
+			return fail(err)
+		}
+		if !seen[e.Path] {
+			seen[e.Path] = true
+			targets = append(targets, e)
+		}
+	}
+	for _, e := range targets {
+		status("  %s  %-8s  %s\n", backup.ID(cfg, e), backup.HumanSize(e.Size), e.Path)
+	}
+
+	if !*force && !session.yes && cfg.Confirmation != "off" {
+		if !isTerminal(os.Stdin) {
+			return fail(errors.New("delete needs --force when nobody is there to confirm"))
+		}
+		reader := bufio.NewReader(os.Stdin)
+		phrase := "DELETE"
+		if len(targets) == 1 {
+			phrase = backup.ID(cfg, targets[0])
+		}
+		if !confirm(cfg, reader, fmt.Sprintf("Delete %d backup(s)?", len(targets)), phrase) {
+			status("Cancelled.\n")
+			return exitFailed
+		}
+		if !ensureOperator(cfg, reader) {
+			return exitFailed
+		}
+	}
+	if cfg.RequireOperator && session.operator == "" {
+		return fail(errors.New("require_operator is set; pass --operator"))
+	}
+	release, err := lockBackupPath(cfg, "delete")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	logger.Info("delete confirmed %s", actor())
+	res := struct {
+		Deleted []string `json:"deleted"`
+		Freed   int64    `json:"freed_bytes"`
+	}{Deleted: []string{}}
+	code := exitOK
+	for _, e := range targets {
+		if err := backup.Delete(e); err != nil {
+			logger.Error("delete %s: %v", e.Path, err)
+			code = exitFailed
+			continue
+		}
+		res.Deleted = append(res.Deleted, backup.ID(cfg, e))
+		res.Freed += e.Size
+	}
+	status("Deleted %d backup(s), freed %s.\n", len(res.Deleted), backup.HumanSize(res.Freed))
+	if session.json {
+		_ = printJSON(res)
+	}
+	return code
+}
+
+// isTerminal reports whether f is an interactive console rather than a
+// pipe, a file or the null device of a scheduled task.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// The null device is a character device too.
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// status prints progress of a command: on stdout normally, on stderr with
+// --output json or backup --stdout so stdout carries only the result.
+func status(format string, a ...any) {
+	if session.json || session.stdoutData {
+		fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
+// pickItems returns the items named in the comma-separated list.
+func pickItems(items []backup.Item, list string) ([]backup.Item, error) {
+	var out []backup.Item
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, it := range items {
+			if it.Name == name {
+				out = append(out, it)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no webapp %q in webapps_path", name)
+		}
+	}
+	return out, nil
+}
+
+// cmdHistory lists the current backups, or with --since what happened to
+// backups from that day on (added, deleted, copied, cancelled), read from
+// lifeboat.log.
+func cmdHistory(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	since := fs.String("since", "", "show events from this day on (YYYY-MM-DD) instead of the current backups")
+	tag := fs.String("tag", "", "only list backups with this tag (see lifeboat tag)")
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *since == "" {
+		entries, err := backup.History(cfg)
+		if err != nil {
+			return fail(err)
+		}
+		if *tag != "" {
+			tagged := entries[:0]
+			for _, e := range entries {
+				if m, err := backup.ReadManifest(e); err == nil && m.HasTag(*tag) {
+					tagged = append(tagged, e)
+				}
+			}
+			entries = tagged
+		}
+		if *asJSON {
+			type row struct {
+				ID   string    `json:"id"`
+				When time.Time `json:"when"`
+				Size int64     `json:"size"`
+				Path string    `json:"path"`
+			}
+			rows := make([]row, 0, len(entries))
+			for _, e := range entries {
+				rows = append(rows, row{backup.ID(cfg, e), e.When, e.Size, e.Path})
+			}
+			return printJSON(rows)
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %s  %-8s  %s\n", backup.ID(cfg, e), e.When.Format("2006-01-02 15:04"), backup.HumanSize(e.Size), e.Path)
+		}
+		return 0
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", *since, time.Local)
+	if err != nil {
+		return fail(errors.New("--since wants a date like 2025-12-01"))
+	}
+	events, err := backup.Events(cfg, from)
+	if err != nil {
+		return fail(err)
+	}
+	if *asJSON {
+		if events == nil {
+			events = []backup.Event{}
+		}
+		return printJSON(events)
+	}
+	if len(events) == 0 {
+		fmt.Println("Nothing logged since", *since)
+		return 0
+	}
+	counts := map[string]int{}
+	for _, ev := range events {
+		id := ev.ID
+		if id == "" {
+			id = ev.Path
+		}
+		line := fmt.Sprintf("%s  %-9s  %-16s  %-8s  %s", ev.Time.Format("2006-01-02 15:04"), ev.Kind, id, ev.Size, ev.Detail)
+		fmt.Println(strings.TrimRight(line, " "))
+		counts[ev.Kind]++
+	}
+	fmt.Printf("\n%d added, %d deleted, %d copied, %d cancelled since %s\n",
+		counts[backup.EventAdded], counts[backup.EventDeleted], counts[backup.EventCopied], counts[backup.EventCancelled], *since)
+	return 0
+}
+
+// cmdLogs: lifeboat logs [-n 50] [--errors] [--follow] [--json]
+// Prints the last lines of lifeboat.log, reaching into the rotated copies
+// when the current file holds fewer than that.
+func cmdLogs(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	n := fs.Int("n", 50, "number of lines to show")
+	onlyErrors := fs.Bool("errors", false, "only show ERROR lines")
+	follow := fs.Bool("follow", false, "keep printing new lines until Ctrl+C")
+	asJSON := fs.Bool("json", session.json, "print JSON instead of the raw lines")
+	if err := fs.Parse(args); err != nil {
+		return exitFailed
+	}
+	if *follow && *asJSON {
+		return fail(errors.New("--follow prints raw lines; it cannot be combined with JSON output"))
+	}
+	keep := func(line string) bool {
+		if !*onlyErrors {
+			return true
+		}
+		_, level, _, ok := logger.ParseLine(line)
+		return ok && level == "ERROR"
+	}
+
+	var tail []string
+	for _, name := range logger.Files(cfg.BackupPath) {
+		f, err := os.Open(name)
+		if err != nil {
+			return fail(err)
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			if keep(sc.Text()) {
+				tail = append(tail, sc.Text())
+				if len(tail) > *n {
+					tail = tail[1:]
+				}
+			}
+		}
+		f.Close()
+	}
+
+	if *asJSON {
+		type line struct {
+			Time    *time.Time `json:"time,omitempty"`
+			Level   string     `json:"level,omitempty"`
+			Message string     `json:"message"`
+		}
+		out := make([]line, 0, len(tail))
+		for _, l := range tail {
+			t, level, msg, ok := logger.ParseLine(l)
+			if !ok {
+				out = append(out, line{Message: l})
+				continue
+			}
+			out = append(out, line{Time: &t, Level: level, Message: msg})
+		}
+		return printJSON(out)
+	}
+	for _, l := range tail {
+		fmt.Println(l)
+	}
+	if !*follow {
+		return exitOK
+	}
+
+	// Poll the current file. A file smaller than what was already read has
+	// been rotated or pruned, so reading starts over from its beginning.
+	path := logger.Path(cfg.BackupPath)
+	var offset int64
+	if fi, err := os.Stat(path); err == nil {
+		offset = fi.Size()
+	}
+	ctx, done := cancellable()
+	defer done()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-tick.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if fi.Size() < offset {
+			offset = 0
+		}
+		if fi.Size() == offset {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		data := make([]byte, fi.Size()-offset)
+		m, _ := f.ReadAt(data, offset)
+		f.Close()
+		data = data[:m]
+		end := bytes.LastIndexByte(data, '\n')
+		if end < 0 {
+			continue
+		}
+		for _, l := range strings.Split(string(data[:end]), "\n") {
+			if l = strings.TrimRight(l, "\r"); keep(l) {
+				fmt.Println(l)
+			}
+		}
+		offset += int64(end + 1)
+	}
+}
+
+// cmdStats: lifeboat stats [--json]
+// Month-by-month sizes and run times, the compression ratio and the
+// largest items, for planning the backup drive.
+func cmdStats(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	st, err := backup.CollectStats(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	if *asJSON {
+		return printJSON(st)
+	}
+	if st.Backups == 0 {
+		fmt.Println("No backups yet.")
+		return 0
+	}
+	fmt.Printf("%d backup(s), %s on disk", st.Backups, backup.HumanSize(st.TotalSize))
+	if st.AvgDuration > 0 {
+		fmt.Printf(", average run %s", st.AvgDuration.Round(time.Second))
+	}
+	if st.Ratio > 0 {
+		fmt.Printf(", stored at %.0f%% of original size", st.Ratio*100)
+	}
+	fmt.Println()
+	fmt.Println()
+	fmt.Println("  Month    Backups  Avg size  Avg original  Avg run")
+	fmt.Println("  -------  -------  --------  ------------  -------")
+	for _, m := range st.Months {
+		orig, run := "-", "-"
+		if m.AvgOriginal > 0 {
+			orig = backup.HumanSize(m.AvgOriginal)
+		}
+		if m.AvgDuration > 0 {
+			run = m.AvgDuration.Round(time.Second).String()
+		}
+		fmt.Printf("  %-7s  %7d  %-8s  %-12s  %s\n", m.Month, m.Backups, backup.HumanSize(m.AvgSize), orig, run)
+	}
+	if n := len(st.Months); n > 1 && st.Months[0].AvgSize > 0 {
+		first, last := st.Months[0], st.Months[n-1]
+		growth := float64(last.AvgSize-first.AvgSize) / float64(first.AvgSize) * 100
+		fmt.Printf("\nAverage backup %s (%s) -> %s (%s), %+.0f%%\n",
+			backup.HumanSize(first.AvgSize), first.Month, backup.HumanSize(last.AvgSize), last.Month, growth)
+	}
+	if len(st.Largest) > 0 {
+		fmt.Println("\nLargest items in the newest backup:")
+		for i, it := range st.Largest {
+			if i == 10 {
+				break
+			}
+			fmt.Printf("  %-8s  %s\n", backup.HumanSize(it.Size), it.Name)
+		}
+	}
+	return 0
+}
+
+// cmdExport: lifeboat export <id> --file bundle.lbx
+// Packs one backup into a single file for another server's lifeboat import.
+func cmdExport(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	file := fs.String("file", "", "bundle to write, e.g. prod-20260421.lbx")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return exitFailed
+	}
+	if *file == "" {
+		return fail(errors.New("export needs --file"))
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	tmp := *file + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, done := cancellable()
+	n, err := backup.Export(ctx, cfg, e, out)
+	done()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, *file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fail(err)
+	}
+	if session.json {
+		return printJSON(struct {
+			ID    string `json:"id"`
+			File  string `json:"file"`
+			Bytes int64  `json:"bytes"`
+		}{backup.ID(cfg, e), *file, n})
+	}
+	fmt.Printf("Exported %s to %s (%s)\n", backup.ID(cfg, e), *file, backup.HumanSize(n))
+	return exitOK
+}
+
+// cmdImport: lifeboat import bundle.lbx
+// Adds a backup exported on another server to backup_path.
+func cmdImport(cfg *config.Config, args []string) int {
+	if cfg.ReadOnly {
+		return fail(errReadOnly)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: lifeboat import <bundle file>")
+		return exitFailed
+	}
+	in, err := os.Open(args[0])
+	if err != nil {
+		return fail(err)
+	}
+	defer in.Close()
+	release, err := lockBackupPath(cfg, "import")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	ctx, done := cancellable()
+	e, meta, err := backup.Import(ctx, cfg, in)
+	done()
+	if err != nil {
+		return fail(err)
+	}
+	logger.Info("import confirmed %s", actor())
+	if session.json {
+		return printJSON(struct {
+			ID     string `json:"id"`
+			From   string `json:"from"`
+			Path   string `json:"path"`
+			Bytes  int64  `json:"bytes"`
+			Origin string `json:"origin_id"`
+		}{backup.ID(cfg, e), meta.Host, e.Path, e.Size, meta.ID})
+	}
+	fmt.Printf("Imported %s from %s (%s) as %s in %s\n", meta.ID, meta.Host, backup.HumanSize(e.Size), backup.ID(cfg, e), e.Path)
+	if cfg.CleanupEnabled() && backup.Classify(cfg, []backup.HistoryEntry{e})[e.Path] == backup.KeepExpired {
+		fmt.Printf("Note: retention already counts it as expired; run lifeboat extend %s --days N to keep it.\n", backup.ID(cfg, e))
+	}
+	return exitOK
+}
+
+// Exit codes of lifeboat health. They follow the Nagios plugin convention
+// instead of exitOK, exitFailed, ...: 1 and 2 mean other things there.
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3 // config error, bad flags
+)
+
+// cmdHealth: lifeboat health [--max-age-hours N] [--min-free SIZE] [--json]
+// A monitoring check: prints one status line (or JSON) and exits 0 OK,
+// 1 WARNING, 2 CRITICAL or 3 UNKNOWN, as Nagios and Zabbix expect.
+func cmdHealth(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	maxAge := fs.Int("max-age-hours", cfg.HealthMaxAgeHours, "newest backup older than this is critical (0 = not checked)")
+	minFree := fs.String("min-free", cfg.HealthMinFree, "less free space on backup_path is critical, e.g. 20GB")
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return nagiosUnknown
+	}
+	lim := backup.HealthLimits{MaxAge: time.Duration(*maxAge) * time.Hour}
+	if strings.TrimSpace(*minFree) != "" {
+		n, err := config.ParseSize(*minFree)
+		if err != nil {
+			printError(fmt.Sprintf("--min-free: %v", err))
+			return nagiosUnknown
+		}
+		lim.MinFree = n
+	}
+	r := backup.Health(cfg, lim)
+	if *asJSON {
+		_ = printJSON(r)
+	} else {
+		worst := ""
+		for _, c := range r.Checks {
+			if c.Status == r.Status {
+				worst = c.Detail
+				break
+			}
+		}
+		fmt.Printf("LIFEBOAT %s - %s: %s\n", r.Status, cfg.Name, worst)
+		for _, c := range r.Checks {
+			fmt.Printf("  %-8s  %-11s  %s\n", c.Status, c.Name, c.Detail)
+		}
+	}
+	switch r.Status {
+	case backup.HealthCritical:
+		return nagiosCritical
+	case backup.HealthWarning:
+		return nagiosWarning
+	}
+	return nagiosOK
+}
+
+// cmdDrift: lifeboat drift <id> [--item NAME] [--json]
+// Lists the files added, changed or deleted in the live webapps and
+// folders since backup <id> was made.
+func cmdDrift(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	item := fs.String("item", "", "only compare this webapp or folder")
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return exitFailed
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	changes, err := backup.Drift(cfg, e)
+	if err != nil {
+		return fail(err)
+	}
+	if *item != "" {
+		kept := changes[:0]
+		for _, c := range changes {
+			if c.Path == *item || strings.HasPrefix(c.Path, *item+"/") {
+				kept = append(kept, c)
+			}
+		}
+		changes = kept
+	}
+	if *asJSON {
+		if changes == nil {
+			changes = []backup.Change{}
+		}
+		return printJSON(changes)
+	}
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+	if len(changes) == 0 {
+		fmt.Printf("No changes since %s.\n", backup.ID(cfg, e))
+		return exitOK
+	}
+	fmt.Printf("Since %s: %d added, %d changed, %d deleted\n\n", backup.ID(cfg, e),
+		counts[backup.DriftAdded], counts[backup.DriftChanged], counts[backup.DriftDeleted])
+	mark := map[string]string{backup.DriftAdded: "+", backup.DriftChanged: "~", backup.DriftDeleted: "-"}
+	for _, c := range changes {
+		fmt.Printf("  %s %s\n", mark[c.Kind], c.Path)
+	}
+	return exitOK
+}
+
+// cmdCatalog: lifeboat catalog push | pull FILE... | list [--json] [--catalog FILE]
+// Keeps the shared catalog at catalog_path: push records this instance's
+// backups, pull merges catalogs other servers wrote elsewhere, list shows
+// the latest backup of every instance in it.
+func cmdCatalog(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		return fail(errors.New("usage: lifeboat catalog push | pull FILE... | list"))
+	}
+	sub := args[0]
+	fs := flag.NewFlagSet("catalog "+sub, flag.ContinueOnError)
+	file := fs.String("catalog", cfg.CatalogPath, "catalog file (default catalog_path)")
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	var files []string
+	for rest := args[1:]; ; {
+		if err := fs.Parse(rest); err != nil {
+			return exitFailed
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files, rest = append(files, fs.Arg(0)), fs.Args()[1:]
+	}
+	if *file == "" {
+		return fail(errors.New("no catalog: set catalog_path in lifeboat.toml or pass --catalog"))
+	}
+
+	switch sub {
+	case "push":
+		e, err := backup.CatalogEntryFor(cfg)
+		if err != nil {
+			return fail(err)
+		}
+		if err := backup.UpdateCatalog(*file, func(c *backup.Catalog) { c.Merge(e) }); err != nil {
+			return fail(err)
+		}
+		logger.Info("catalog push %s backups=%d %s", *file, len(e.Backups), actor())
+		status("Pushed %d backup(s) of %s/%s to %s\n", len(e.Backups), e.Host, e.Instance, *file)
+		return 0
+	case "pull":
+		if len(files) == 0 {
+			return fail(errors.New("usage: lifeboat catalog pull FILE..."))
+		}
+		var from []backup.CatalogEntry
+		for _, p := range files {
+			c, err := backup.ReadCatalog(p)
+			if err != nil {
+				return fail(err)
+			}
+			from = append(from, c.Entries...)
+		}
+		merged := 0
+		err := backup.UpdateCatalog(*file, func(c *backup.Catalog) {
+			for _, e := range from {
+				if c.Merge(e) {
+					merged++
+				}
+			}
+		})
+		if err != nil {
+			return fail(err)
+		}
+		logger.Info("catalog pull %s merged=%d %s", *file, merged, actor())
+		status("Merged %d of %d catalog entries into %s\n", merged, len(from), *file)
+		return 0
+	case "list":
+	default:
+		return fail(fmt.Errorf("unknown catalog command %q (push, pull or list)", sub))
+	}
+
+	c, err := backup.ReadCatalog(*file)
+	if err != nil {
+		return fail(err)
+	}
+	if *asJSON {
+		return printJSON(c)
+	}
+	if len(c.Entries) == 0 {
+		fmt.Println("The catalog is empty; run lifeboat catalog push on each server.")
+		return 0
+	}
+	fmt.Println("  Host             Instance         Backups  Latest                Age      Pushed")
+	fmt.Println("  ---------------  ---------------  -------  --------------------  -------  ----------------")
+	for _, e := range c.Entries {
+		latest, age := "-", "-"
+		if b, ok := e.Latest(); ok {
+			latest, age = b.ID, shortAge(time.Since(b.When))
+		}
+		fmt.Printf("  %-15s  %-15s  %7d  %-20s  %-7s  %s\n", e.Host, e.Instance, len(e.Backups), latest, age, e.Updated.Format("2006-01-02 15:04"))
+	}
+	return 0
+}
+
+// shortAge formats d as minutes, hours or days, whichever fits.
+func shortAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// cmdInfo: lifeboat info <id> [--json] [--config]
+// Everything known about one backup: what it contains, its manifest
+// metadata and note, where it stands with retention and replication.
+func cmdInfo(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	showConfig := fs.Bool("config", false, "print the configuration the backup was made with")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return 1
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	if *showConfig {
+		m, err := backup.ReadManifest(e)
+		if err != nil || m.Config == "" {
+			return fail(fmt.Errorf("no configuration recorded for %s", backup.ID(cfg, e)))
+		}
+		fmt.Print(m.Config)
+		return 0
+	}
+	contents, err := backup.Contents(e)
+	if err != nil {
+		return fail(err)
+	}
+	entries, err := backup.History(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	keep := backup.Classify(cfg, entries)[e.Path]
+	expires := backup.Expires(cfg, e)
+	m, merr := backup.ReadManifest(e)
+
+	if *asJSON {
+		type manifestInfo struct {
+			Name        string    `json:"name"`
+			Host        string    `json:"host"`
+			Version     string    `json:"lifeboat_version"`
+			Created     time.Time `json:"created"`
+			Finished    time.Time `json:"finished"`
+			Consistency string    `json:"consistency"`
+			Note        string    `json:"note,omitempty"`
+			Tags        []string  `json:"tags,omitempty"`
+			Files       int       `json:"files"`
+		}
+		out := struct {
+			ID       string            `json:"id"`
+			Path     string            `json:"path"`
+			When     time.Time         `json:"when"`
+			Size     int64             `json:"size"`
+			Contents []backup.ItemSize `json:"contents"`
+			Keep     string            `json:"keep"`
+			Expires  *time.Time        `json:"expires,omitempty"`
+			Replica  string            `json:"replica"`
+			Manifest *manifestInfo     `json:"manifest,omitempty"`
+		}{
+			ID: backup.ID(cfg, e), Path: e.Path, When: e.When, Size: e.Size,
+			Contents: contents, Keep: keep, Replica: replicaStatus(cfg, e),
+		}
+		if !expires.IsZero() {
+			out.Expires = &expires
+		}
+		if merr == nil {
+			out.Manifest = &manifestInfo{m.Name, m.Host, m.Version, m.Created, m.Finished, m.Consistency, m.Note, m.Tags, len(m.Files)}
+		}
+		return printJSON(out)
+	}
+
+	fmt.Printf("Backup   %s\n", backup.ID(cfg, e))
+	fmt.Printf("Path     %s\n", e.Path)
+	fmt.Printf("Created  %s\n", e.When.Format("2006-01-02 15:04"))
+	fmt.Printf("Size     %s\n", backup.HumanSize(e.Size))
+	switch {
+	case !expires.IsZero() && keep != backup.KeepExpired:
+		fmt.Printf("Keep     %s, expires %s (in %d days)\n", keep, expires.Format("2006-01-02"), int(time.Until(expires).Hours()/24))
+		if !e.KeepUntil.IsZero() {
+			fmt.Printf("         extended to %s by lifeboat extend\n", e.KeepUntil.Format("2006-01-02"))
+		}
+	case keep == backup.KeepExpired:
+		fmt.Printf("Keep     %s, deleted by the next cleanup\n", keep)
+	default:
+		fmt.Printf("Keep     %s (%s)\n", keep, retentionRule(cfg))
+	}
+	fmt.Printf("Replica  %s\n", replicaStatus(cfg, e))
+	if merr != nil {
+		fmt.Println("Manifest none (made before manifests existed)")
+	} else {
+		fmt.Printf("Source   %s on %s, lifeboat %s\n", m.Name, m.Host, m.Version)
+		if m.Consistency != "" {
+			fmt.Printf("Run      %s, %s\n", m.Finished.Sub(m.Created).Round(time.Second), m.Consistency)
+		}
+		if m.Note != "" {
+			fmt.Printf("Note     %s\n", m.Note)
+		}
+		if len(m.Tags) > 0 {
+			fmt.Printf("Tags     %s\n", strings.Join(m.Tags, ", "))
+		}
+		fmt.Printf("Files    %d\n", len(m.Files))
+	}
+	fmt.Println()
+	for _, c := range contents {
+		fmt.Printf("  %-8s  %s\n", backup.HumanSize(c.Size), c.Name)
+	}
+	return 0
+}
+
+// cmdSearch: lifeboat search <text>
+// Lists the backups whose note (see note_command) contains text, ignoring
+// case.
+func cmdSearch(cfg *config.Config, args []string) int {
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		fmt.Fprintln(os.Stderr, "Usage: lifeboat search <text>")
+		return 1
+	}
+	want := strings.ToLower(args[0])
+	entries, err := backup.History(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	type hit struct {
+		ID   string    `json:"id"`
+		When time.Time `json:"when"`
+		Note string    `json:"note"`
+	}
+	hits := []hit{}
+	for _, e := range entries {
+		m, err := backup.ReadManifest(e)
+		if err != nil || !strings.Contains(strings.ToLower(m.Note), want) {
+			continue
+		}
+		hits = append(hits, hit{backup.ID(cfg, e), e.When, m.Note})
+	}
+	if session.json {
+		_ = printJSON(hits)
+	} else {
+		for _, h := range hits {
+			fmt.Printf("%s  %s  %s\n", h.ID, h.When.Format("2006-01-02 15:04"), h.Note)
+		}
+	}
+	if len(hits) == 0 && !session.json {
+		fmt.Println("No backup note contains", args[0])
+	}
+	if len(hits) == 0 {
+		return exitNoMatch
+	}
+	return 0
+}
+
+// cmdNote: lifeboat note <id> ["text"]
+// Prints the note of a backup, or replaces it; "" removes it.
+func cmdNote(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("note", flag.ContinueOnError)
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return exitFailed
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	res := struct {
+		ID   string `json:"id"`
+		Note string `json:"note"`
+	}{ID: backup.ID(cfg, e)}
+	if fs.NArg() == 0 {
+		m, err := backup.ReadManifest(e)
+		if err != nil {
+			return fail(err)
+		}
+		res.Note = m.Note
+	} else {
+		if cfg.ReadOnly {
+			return fail(errReadOnly)
+		}
+		res.Note = strings.Join(fs.Args(), " ")
+		release, err := lockBackupPath(cfg, "note")
+		if err != nil {
+			return fail(err)
+		}
+		err = backup.SetNote(cfg, e, res.Note)
+		release()
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if session.json {
+		return printJSON(res)
+	}
+	if res.Note == "" {
+		fmt.Println(res.ID, "has no note.")
+		return exitOK
+	}
+	fmt.Printf("%s  %s\n", res.ID, res.Note)
+	return exitOK
+}
+
+// cmdTag: lifeboat tag <id> [tag,tag...] [--remove]
+// Shows the tags of a backup, adds the given ones, or with --remove takes
+// them off. lifeboat history --tag lists the backups carrying one.
+func cmdTag(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	remove := fs.Bool("remove", false, "take the given tags off instead of adding them")
+	id, err := parseWithID(fs, args)
+	if err != nil {
+		return exitFailed
+	}
+	// Tags and --remove may come in any order.
+	var given []string
+	for rest := fs.Args(); len(rest) > 0; rest = fs.Args() {
+		given = append(given, strings.Split(rest[0], ",")...)
+		if err := fs.Parse(rest[1:]); err != nil {
+			return exitFailed
+		}
+	}
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		return fail(err)
+	}
+	m, err := backup.ReadManifest(e)
+	if err != nil {
+		return fail(err)
+	}
+	res := struct {
+		ID   string   `json:"id"`
+		Tags []string `json:"tags"`
+	}{ID: backup.ID(cfg, e), Tags: m.Tags}
+	if len(given) > 0 {
+		if cfg.ReadOnly {
+			return fail(errReadOnly)
+		}
+		var tags []string
+		if *remove {
+			drop := map[string]bool{}
+			for _, t := range given {
+				drop[strings.ToLower(strings.TrimSpace(t))] = true
+			}
+			for _, t := range m.Tags {
+				if !drop[t] {
+					tags = append(tags, t)
+				}
+			}
+		} else {
+			tags = append(m.Tags, given...)
+		}
+		release, err := lockBackupPath(cfg, "tag")
+		if err != nil {
+			return fail(err)
+		}
+		err = backup.SetTags(cfg, e, tags)
+		release()
+		if err != nil {
+			return fail(err)
+		}
+		if m, err = backup.ReadManifest(e); err != nil {
+			return fail(err)
+		}
+		res.Tags = m.Tags
+	}
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	if session.json {
+		return printJSON(res)
+	}
+	if len(res.Tags) == 0 {
+		fmt.Println(res.ID, "has no tags.")
+		return exitOK
+	}
+	fmt.Printf("%s  %s\n", res.ID, strings.Join(res.Tags, ", "))
+	return exitOK
+}
+
+// printJSON writes v indented to stdout.
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// cmdValidate: lifeboat validate [file]
+// Loads the config like every run does and checks that the folders it
+// names exist, without touching any backup.
+func cmdValidate(args []string) int {
+	path := config.DefaultFile
+	if len(args) > 0 {
+		path = args[0]
+	}
+	res := struct {
+		File     string   `json:"file"`
+		Valid    bool     `json:"valid"`
+		Error    string   `json:"error,omitempty"`
+		Warnings []string `json:"warnings"`
+	}{File: path, Warnings: []string{}}
+	cfg, err := config.Load(path)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Valid = true
+		check := func(what, dir string) {
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("%s %s is not a reachable folder", what, dir))
+			}
+		}
+		check("webapps_path", cfg.WebappsPath)
+		check("backup_path", cfg.BackupPath)
+		for _, f := range cfg.ExtraFolders {
+			check("extra_folders entry", f)
+		}
+		for _, in := range cfg.Instances {
+			ic, _ := cfg.ForInstance(in.Name)
+			check("instance "+in.Name+" webapps_path", ic.WebappsPath)
+		}
+	}
+	if session.json {
+		_ = printJSON(res)
+	} else if !res.Valid {
+		fmt.Fprintln(os.Stderr, "ERROR:", res.Error)
+	} else {
+		fmt.Println(path, "is valid.")
+		for _, w := range res.Warnings {
+			fmt.Println("WARN:", w)
+		}
+	}
+	if !res.Valid {
+		return exitConfig
+	}
+	return exitOK
+}
+
+// cmdDetect lists the Tomcat installs found on this machine. It needs no
+// lifeboat.toml, so it also helps while writing the first one.
+func cmdDetect(args []string) int {
+	fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+	asJSON := fs.Bool("json", session.json, "print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	installs := tomcat.Detect()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if installs == nil {
+			installs = []tomcat.Install{}
+		}
+		if err := enc.Encode(installs); err != nil {
+			return 1
+		}
+		return 0
+	}
+	if len(installs) == 0 {
+		fmt.Println("No Tomcat found via CATALINA_BASE/CATALINA_HOME, services or the usual folders.")
+		return 1
+	}
+	for _, in := range installs {
+		fmt.Printf("%s  (%s)\n", in.Home, in.Source)
+		fmt.Printf("  webapps_path   = %q\n", filepath.ToSlash(in.Webapps))
+		fmt.Printf("  extra_folders  = [%q]\n", filepath.ToSlash(filepath.Join(in.Home, "conf")))
+		if in.Service != "" {
+			fmt.Printf("  tomcat_service = %q\n", in.Service)
+		}
+		fmt.Println()
+	}
+	return 0
+}
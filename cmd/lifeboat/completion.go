@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kannan/tts-lifeboat/internal/backup"
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// commandNames are the commands shell completion offers; keep in step with
+// runCommand and the early commands in main.
+var commandNames = []string{
+	"init", "wizard", "detect", "validate", "backup", "cleanup", "logs",
+	"history", "stats", "health", "search", "info", "drift", "note", "tag",
+	"extend", "delete", "browse", "inspect", "manifest", "replicate", "sync",
+	"catalog", "export", "import", "completion",
+}
+
+// idCommands take backup IDs, which completion looks up in backup_path.
+var idCommands = []string{
+	"browse", "inspect", "manifest", "replicate", "note", "tag", "delete", "extend",
+	"info", "drift", "export",
+}
+
+// cmdCompletion: lifeboat completion bash|zsh|fish|powershell
+// Prints a completion script for the shell. Backup IDs are completed by
+// calling `lifeboat __complete-ids` at the time of completion, so they are
+// always current.
+func cmdCompletion(global *flag.FlagSet, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: lifeboat completion bash|zsh|fish|powershell")
+		return exitFailed
+	}
+	var flags, valueFlags []string
+	global.VisitAll(func(f *flag.Flag) {
+		if f.Usage == "" {
+			return // hidden, like --chaos
+		}
+		flags = append(flags, "--"+f.Name)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			valueFlags = append(valueFlags, "--"+f.Name)
+		}
+	})
+	quote := func(list []string) string {
+		return "'" + strings.Join(list, "', '") + "'"
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = "autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion
+	case "fish":
+		script = fishCompletion
+	case "powershell":
+		script = powershellCompletion
+	default:
+		return fail(fmt.Errorf("unknown shell %q (bash, zsh, fish or powershell)", args[0]))
+	}
+	fmt.Print(strings.NewReplacer(
+		"@COMMANDS@", strings.Join(commandNames, " "),
+		"@IDCMDS_BASH@", strings.Join(idCommands, "|"),
+		"@IDCMDS@", strings.Join(idCommands, " "),
+		"@FLAGS@", strings.Join(flags, " "),
+		"@VALUEFLAGS_BASH@", strings.Join(valueFlags, "|"),
+		"@PS_COMMANDS@", quote(commandNames),
+		"@PS_IDCMDS@", quote(idCommands),
+		"@PS_FLAGS@", quote(flags),
+		"@PS_VALUEFLAGS@", quote(valueFlags),
+	).Replace(script))
+	return exitOK
+}
+
+// completeIDs prints "latest" and every backup ID, one per line, for the
+// completion scripts. Nothing is logged: it runs on every Tab press.
+func completeIDs(cfg *config.Config) int {
+	entries, err := backup.History(cfg)
+	if err != nil {
+		return exitFailed
+	}
+	fmt.Println("latest")
+	for _, e := range entries {
+		fmt.Println(backup.ID(cfg, e))
+	}
+	return exitOK
+}
+
+const bashCompletion = `# lifeboat completion for bash; load with: source <(lifeboat completion bash)
+_lifeboat() {
+    local cur cmd i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    cmd=""
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            @VALUEFLAGS_BASH@) ((i++)) ;;
+            -*) ;;
+            *) cmd="${COMP_WORDS[i]}"; break ;;
+        esac
+    done
+    if [[ -z "$cmd" && "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "@FLAGS@" -- "$cur"))
+        return
+    fi
+    case "$cmd" in
+        "") COMPREPLY=($(compgen -W "@COMMANDS@" -- "$cur")) ;;
+        @IDCMDS_BASH@) [[ "$cur" != -* ]] && COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" __complete-ids 2>/dev/null)" -- "$cur")) ;;
+        catalog) COMPREPLY=($(compgen -W "push pull list" -- "$cur")) ;;
+        completion) COMPREPLY=($(compgen -W "bash zsh fish powershell" -- "$cur")) ;;
+    esac
+}
+complete -o default -F _lifeboat lifeboat
+`
+
+const fishCompletion = `# lifeboat completion for fish; load with: lifeboat completion fish | source
+complete -c lifeboat -f
+complete -c lifeboat -n __fish_use_subcommand -a "@COMMANDS@"
+complete -c lifeboat -n "__fish_seen_subcommand_from @IDCMDS@" -a "(lifeboat __complete-ids 2>/dev/null)"
+complete -c lifeboat -n "__fish_seen_subcommand_from catalog" -a "push pull list"
+complete -c lifeboat -n "__fish_seen_subcommand_from completion" -a "bash zsh fish powershell"
+for f in @FLAGS@
+    complete -c lifeboat -n __fish_use_subcommand -l (string sub -s 3 -- $f)
+end
+`
+
+const powershellCompletion = `# lifeboat completion for PowerShell; load with:
+#   lifeboat completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName lifeboat, lifeboat.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -and $words.Count -gt 0) { $words = @($words | Select-Object -First ($words.Count - 1)) }
+    $cmd = $null; $skip = $false
+    foreach ($w in $words) {
+        if ($skip) { $skip = $false; continue }
+        if (@(@PS_VALUEFLAGS@) -contains $w) { $skip = $true; continue }
+        if ($w -like '-*') { continue }
+        $cmd = $w; break
+    }
+    if (-not $cmd -and $wordToComplete -like '-*') { $candidates = @(@PS_FLAGS@) }
+    elseif (-not $cmd) { $candidates = @(@PS_COMMANDS@) }
+    elseif (@(@PS_IDCMDS@) -contains $cmd) { $candidates = @(& $commandAst.CommandElements[0].ToString() __complete-ids 2>$null) }
+    elseif ($cmd -eq 'catalog') { $candidates = @('push', 'pull', 'list') }
+    elseif ($cmd -eq 'completion') { $candidates = @('bash', 'zsh', 'fish', 'powershell') }
+    else { return }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
@@ -3,58 +3,225 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"os/user"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kannan/tts-lifeboat/internal/app"
 	"github.com/kannan/tts-lifeboat/internal/backup"
 	"github.com/kannan/tts-lifeboat/internal/config"
 	"github.com/kannan/tts-lifeboat/internal/logger"
+	"github.com/kannan/tts-lifeboat/internal/notify"
+	"github.com/kannan/tts-lifeboat/internal/tomcat"
 )
 
+// session identifies who is driving this run. The OS account alone is not
+// enough on shared admin logins, so an optional --operator name is recorded
+// alongside it on every destructive action.
+var session struct {
+	user     string
+	operator string
+	json     bool // --output json
+	yes      bool // --yes / --non-interactive: never prompt
+	wait     bool // --wait: queue behind a held run lock instead of refusing
+	// stdoutData is set while stdout carries an archive (backup --stdout).
+	stdoutData bool
+}
+
 func main() {
 	reader := bufio.NewReader(os.Stdin)
 
+	fs := flag.NewFlagSet("lifeboat", flag.ExitOnError)
+	fs.StringVar(&session.operator, "operator", "", "name or ID of the person running lifeboat (recorded in the log)")
+	readOnly := fs.Bool("read-only", false, "disable every action that writes or deletes backups")
+	withConf := fs.Bool("with-conf", false, "also back up Tomcat conf/, custom lib/ jars and bin/setenv.*")
+	stopTomcat := fs.Bool("stop-tomcat", false, "stop Tomcat (tomcat_service) during the backup")
+	throttle := fs.Float64("throttle", -1, "limit copy speed to this many MB/s (overrides max_mb_per_sec, 0 = unlimited)")
+	output := fs.String("output", "text", "result format of commands: text or json")
+	instance := fs.String("instance", "", "use the named [[instances]] entry from lifeboat.toml")
+	allInstances := fs.Bool("all-instances", false, "run the given command once for every [[instances]] entry")
+	forceUnlock := fs.Bool("force-unlock", false, "remove backup_path's run lock left by a crashed or killed lifeboat")
+	fs.BoolVar(&session.wait, "wait", false, "wait for a running lifeboat on the same backup_path to finish instead of refusing to start")
+	fs.BoolVar(&session.yes, "yes", false, "never prompt; destructive commands go ahead without confirmation")
+	fs.BoolVar(&session.yes, "non-interactive", false, "same as --yes")
+	// --chaos is deliberately left out of the usage text: it exists only to
+	// rehearse failure runbooks, e.g. --chaos fail-after=3,slow=200ms,disk-full
+	chaos := fs.String("chaos", "", "")
+	fs.Usage = func() { printUsage(fs, "chaos") }
+	_ = fs.Parse(os.Args[1:])
+	if *chaos != "" {
+		c, err := backup.ParseChaos(*chaos)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			os.Exit(1)
+		}
+		backup.Chaos = c
+	}
+	args := fs.Args()
+	session.user = osUser()
+	switch *output {
+	case "text":
+	case "json":
+		session.json = true
+	default:
+		fmt.Fprintln(os.Stderr, "ERROR: --output must be text or json")
+		os.Exit(1)
+	}
+
 	// `lifeboat init` writes a starter TOML next to the binary and exits.
-	if len(os.Args) > 1 && os.Args[1] == "init" {
+	if len(args) > 0 && args[0] == "init" {
 		if err := writeInitTemplate(); err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
 		}
 		return
 	}
+	if len(args) > 0 && args[0] == "detect" {
+		os.Exit(cmdDetect(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "wizard" {
+		if session.yes {
+			fmt.Fprintln(os.Stderr, "ERROR: the wizard asks questions; use `lifeboat init` when running non-interactively")
+			os.Exit(exitFailed)
+		}
+		if err := runWizard(reader); errors.Is(err, errCancelled) {
+			fmt.Println("Cancelled.")
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "validate" {
+		os.Exit(cmdValidate(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "completion" {
+		os.Exit(cmdCompletion(fs, args[1:]))
+	}
+	if len(args) > 0 && args[0] == "__complete-ids" {
+		cfg, err := config.Load("")
+		if err == nil && *instance != "" {
+			cfg, err = cfg.ForInstance(*instance)
+		}
+		if err != nil {
+			os.Exit(exitConfig)
+		}
+		os.Exit(completeIDs(cfg))
+	}
 
 	cfg, err := config.Load("")
+	if err != nil && session.json {
+		printError(err.Error())
+		os.Exit(exitConfig)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "ERROR:", err)
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Create lifeboat.toml next to this executable.")
-		fmt.Fprintln(os.Stderr, "Run `lifeboat init` to generate a template.")
-		pause(reader)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Run `lifeboat wizard` for guided setup, or `lifeboat init` for a template.")
+		if len(args) == 0 && !session.yes {
+			pause(reader)
+		}
+		os.Exit(exitConfig)
 	}
-	if err := logger.Init(cfg.BackupPath); err != nil {
-		fmt.Fprintln(os.Stderr, "WARN: could not open log file:", err)
+	if *instance != "" {
+		if *allInstances {
+			fmt.Fprintln(os.Stderr, "ERROR: use either --instance or --all-instances")
+			os.Exit(1)
+		}
+		if cfg, err = cfg.ForInstance(*instance); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			os.Exit(exitConfig)
+		}
+	}
+	if *readOnly {
+		cfg.ReadOnly = true
+	}
+	if *withConf {
+		cfg.IncludeTomcatConf = true
+	}
+	if *throttle >= 0 {
+		cfg.MaxMBPerSec = *throttle
+	}
+	backup.SetThrottle(cfg.MaxMBPerSec)
+	backup.SetCompressionThreads(cfg.CompressionThreads)
+	if *stopTomcat {
+		if cfg.TomcatService == "" {
+			fmt.Fprintln(os.Stderr, "ERROR: --stop-tomcat needs tomcat_service in lifeboat.toml")
+			os.Exit(exitConfig)
+		}
+		cfg.StopTomcat = true
+	}
+	if session.yes && len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: --yes needs a command, e.g. lifeboat --yes backup")
+		os.Exit(exitFailed)
+	}
+	if *allInstances {
+		if *forceUnlock {
+			fmt.Fprintln(os.Stderr, "ERROR: use --force-unlock with --instance, one backup_path at a time")
+			os.Exit(exitFailed)
+		}
+		watchInterrupts()
+		os.Exit(runAllInstances(cfg, args))
 	}
+	openLog(cfg)
 	defer logger.Close()
-	logger.Info("session start name=%s webapps=%s backup=%s", cfg.Name, cfg.WebappsPath, cfg.BackupPath)
+	watchInterrupts()
+	logger.Info("session start name=%s webapps=%s backup=%s %s", cfg.Name, cfg.WebappsPath, cfg.BackupPath, actor())
+	if *forceUnlock {
+		held, ok, err := backup.ForceUnlock(cfg)
+		switch {
+		case err != nil:
+			printError(err.Error())
+			os.Exit(exitFailed)
+		case ok:
+			logger.Info("force-unlock confirmed %s", actor())
+			status("Removed the run lock of lifeboat %s (pid %d on %s, since %s).\n",
+				held.Command, held.PID, held.Host, held.Started.Format("2006-01-02 15:04"))
+		default:
+			status("backup_path was not locked.\n")
+		}
+	}
+
+	if len(args) > 0 {
+		code := runCommand(cfg, args)
+		logger.Close()
+		os.Exit(code)
+	}
 
 	for {
 		clearScreen()
 		printHeader(cfg)
 		printMenu(cfg)
-		choice := strings.TrimSpace(readLine(reader, "Enter your choice (1-4): "))
+		choice := strings.TrimSpace(readLine(reader, "Enter your choice (1-5): "))
 		switch choice {
 		case "1":
+			if refuseReadOnly(cfg, reader) {
+				continue
+			}
 			runNewBackup(cfg, reader)
 		case "2":
 			runHistory(cfg, reader)
 		case "3":
+			if refuseReadOnly(cfg, reader) {
+				continue
+			}
 			runCleanup(cfg, reader)
-		case "4", "q", "Q":
+		case "4":
+			runSettings(cfg, reader, *instance)
+		case "5", "q", "Q":
 			fmt.Println("Goodbye.")
 			return
 		default:
@@ -64,11 +231,94 @@ func main() {
 	}
 }
 
+// runAllInstances runs one command against every [[instances]] entry in
+// turn, each logging to its own backup_path. The exit code is the most
+// serious any instance returned (see exitPrecedence; healthPrecedence for
+// health), so a scheduled run fails if one Tomcat did.
+func runAllInstances(base *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: --all-instances needs a command, e.g. lifeboat --all-instances sync")
+		return 1
+	}
+	if len(base.Instances) == 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: --all-instances: no [[instances]] in lifeboat.toml")
+		return 1
+	}
+	order := exitPrecedence
+	if args[0] == "health" {
+		order = healthPrecedence
+	}
+	result := -1
+	for _, in := range base.Instances {
+		cfg, err := base.ForInstance(in.Name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			return exitConfig
+		}
+		status("== %s ==\n", cfg.Name)
+		openLog(cfg)
+		logger.Info("session start name=%s webapps=%s backup=%s %s", cfg.Name, cfg.WebappsPath, cfg.BackupPath, actor())
+		code := runCommand(cfg, args)
+		if result < 0 {
+			result = code
+		} else {
+			result = moreSerious(order, result, code)
+		}
+		logger.Close()
+		status("\n")
+	}
+	return result
+}
+
+// exitPrecedence orders exit codes from most to least serious, for
+// combining the results of several instances: one that failed and one
+// that completed with warnings make exitFailed, not exitWarnings.
+// exitNoMatch comes after exitOK, so it is the result only when search
+// found nothing in any instance.
+var exitPrecedence = []int{exitConfig, exitFailed, exitWarnings, exitOK, exitNoMatch}
+
+// healthPrecedence does the same for health's Nagios codes: any CRITICAL
+// instance makes the run CRITICAL, then WARNING, then UNKNOWN.
+var healthPrecedence = []int{nagiosCritical, nagiosWarning, nagiosUnknown, nagiosOK}
+
+// moreSerious returns whichever of a and b comes first in order. A code
+// order does not list counts as more serious than any it does.
+func moreSerious(order []int, a, b int) int {
+	rank := func(code int) int {
+		for i, c := range order {
+			if c == code {
+				return i
+			}
+		}
+		return -1
+	}
+	if rank(b) < rank(a) {
+		return b
+	}
+	return a
+}
+
+// openLog opens cfg's lifeboat.log with its rotation settings. Without a
+// log lifeboat still runs, errors then only reach stderr.
+func openLog(cfg *config.Config) {
+	size, _ := cfg.LogMaxBytes()
+	logger.SetRotation(size, cfg.LogMaxFiles)
+	if err := logger.Init(cfg.BackupPath); err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: could not open log file:", err)
+	}
+}
+
 func printHeader(cfg *config.Config) {
 	fmt.Println("===============================================")
 	fmt.Println("   TTS LIFEBOAT v" + app.Version)
 	fmt.Println("   Created by " + app.Creator + " from TTS")
 	fmt.Println("   Project: " + cfg.Name)
+	if cfg.ReadOnly {
+		fmt.Println("   Mode:    READ-ONLY")
+	}
+	if st, err := backup.ReadState(cfg); err == nil && st.Failures > 0 {
+		fmt.Printf("   LAST BACKUP FAILED (%d in a row, %s): %s\n", st.Failures, st.LastAttempt.Format("2006-01-02 15:04"), st.LastError)
+	}
 	fmt.Println("===============================================")
 	fmt.Println()
 }
@@ -76,18 +326,29 @@ func printHeader(cfg *config.Config) {
 func printMenu(cfg *config.Config) {
 	fmt.Println("What would you like to do?")
 	fmt.Println()
-	fmt.Println("  1. Create New Backup")
+	if cfg.ReadOnly {
+		fmt.Println("  1. Create New Backup (disabled: read-only)")
+	} else {
+		fmt.Println("  1. Create New Backup")
+	}
 	fmt.Println("  2. View Backup History")
-	if cfg.RetentionDays > 0 {
-		fmt.Printf("  3. Cleanup Old Backups (older than %d days)\n", cfg.RetentionDays)
+	if cfg.ReadOnly {
+		fmt.Println("  3. Cleanup Old Backups (disabled: read-only)")
+	} else if cfg.CleanupEnabled() {
+		fmt.Printf("  3. Cleanup Old Backups (%s)\n", retentionRule(cfg))
 	} else {
 		fmt.Println("  3. Cleanup Old Backups (disabled: retention_days = 0)")
 	}
-	fmt.Println("  4. Exit")
+	fmt.Println("  4. Settings")
+	fmt.Println("  5. Exit")
 	fmt.Println()
 }
 
 func runNewBackup(cfg *config.Config, reader *bufio.Reader) {
+	if err := backup.BudgetPreflight(cfg); err != nil {
+		pause(reader)
+		return
+	}
 	items, err := backup.ListWebapps(cfg)
 	if err != nil {
 		fmt.Println("ERROR:", err)
@@ -111,7 +372,11 @@ func runNewBackup(cfg *config.Config, reader *bufio.Reader) {
 	}
 	fmt.Println()
 
-	input := strings.TrimSpace(readLine(reader, "Enter numbers to backup (e.g. 1,3  or blank for ALL): "))
+	input := strings.TrimSpace(readLine(reader, "Enter numbers to backup (e.g. 1,3  blank for ALL, q to cancel): "))
+	if isQuit(input) {
+		fmt.Println("Cancelled.")
+		return
+	}
 	selected, err := backup.ParseSelection(input, len(items))
 	if err != nil {
 		fmt.Println("ERROR:", err)
@@ -126,15 +391,51 @@ func runNewBackup(cfg *config.Config, reader *bufio.Reader) {
 			chosen = append(chosen, items[n-1])
 		}
 	}
+	runCfg, ok := pickExtras(cfg, reader)
+	if !ok {
+		fmt.Println("Cancelled.")
+		return
+	}
+	cfg = runCfg
+	note := strings.TrimSpace(readLine(reader, "Note for this backup (optional, Enter to skip): "))
+	if isQuit(note) {
+		fmt.Println("Cancelled.")
+		return
+	}
 
 	fmt.Println()
+	release, err := lockBackupPath(cfg, "backup")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		pause(reader)
+		return
+	}
+	defer release()
+	if cfg.StopTomcat {
+		if !stopTomcatFor(cfg) {
+			pause(reader)
+			return
+		}
+	}
 	fmt.Printf("Backing up %d items (compression=%v)...\n", len(chosen), cfg.Compression)
 	start := time.Now()
-	dest, bytes, err := backup.Run(cfg, chosen, func(step, total int, name string) {
+	ctx, done := cancellable()
+	dest, bytes, err := backup.Run(backup.WithNote(ctx, note), cfg, chosen, func(step, total int, name string) {
 		fmt.Printf("  [%d/%d] %s\n", step, total, name)
 	})
+	done()
+	if cfg.StopTomcat {
+		startTomcatAfter(cfg)
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Backup cancelled.")
+		pause(reader)
+		return
+	}
+	backup.RecordResult(cfg, dest, err)
 	if err != nil {
 		fmt.Println("ERROR:", err)
+		notifyDone(cfg, "Backup FAILED", err.Error())
 		pause(reader)
 		return
 	}
@@ -143,9 +444,69 @@ func runNewBackup(cfg *config.Config, reader *bufio.Reader) {
 	fmt.Println("  Location:", dest)
 	fmt.Println("  Size:    ", backup.HumanSize(bytes))
 	fmt.Println("  Duration:", time.Since(start).Round(time.Millisecond))
+	if cfg.ReplicaPath != "" {
+		replicateAfterBackup(cfg)
+	}
+	cleanupAfterBackup(cfg)
+	backup.CheckBudget(cfg)
+	notifyDone(cfg, "Backup complete", fmt.Sprintf("%s: %s in %s", cfg.Name, backup.HumanSize(bytes), dest))
 	pause(reader)
 }
 
+// pickExtras lets the user leave out some of the extra_folders (and the
+// Tomcat configuration, when include_tomcat_conf is on) for this one
+// backup. It returns the config to run with: cfg itself when everything
+// stays in. ok is false if the user cancelled.
+func pickExtras(cfg *config.Config, reader *bufio.Reader) (*config.Config, bool) {
+	names := append([]string{}, cfg.ExtraFolders...)
+	if cfg.IncludeTomcatConf {
+		names = append(names, "Tomcat configuration (conf/, custom lib/ jars, bin/setenv.*)")
+	}
+	if len(names) == 0 {
+		return cfg, true
+	}
+	fmt.Println("\nAlso backed up:")
+	for i, n := range names {
+		fmt.Printf("  [%2d] %s\n", i+1, n)
+	}
+	fmt.Println()
+	for {
+		input := strings.TrimSpace(readLine(reader, "Enter numbers to include (blank for ALL, 0 for none, q to cancel): "))
+		if isQuit(input) {
+			return nil, false
+		}
+		if input == "" {
+			return cfg, true
+		}
+		var selected []int
+		if input != "0" {
+			var err error
+			if selected, err = backup.ParseSelection(input, len(names)); err != nil {
+				fmt.Println("ERROR:", err)
+				continue
+			}
+		}
+		run := *cfg
+		run.ExtraFolders = nil
+		run.IncludeTomcatConf = false
+		for _, n := range selected {
+			if n > len(cfg.ExtraFolders) {
+				run.IncludeTomcatConf = true
+				continue
+			}
+			run.ExtraFolders = append(run.ExtraFolders, cfg.ExtraFolders[n-1])
+		}
+		logger.Info("extra folders for this backup: %d of %d", len(selected), len(names))
+		return &run, true
+	}
+}
+
+// historyPageSize is how many backups the history view shows at a time.
+const historyPageSize = 20
+
+// runHistory shows the backups a page at a time. Single-key commands page
+// through them, sort by size instead of date, show only expired ones or
+// filter on the note_command note.
 func runHistory(cfg *config.Config, reader *bufio.Reader) {
 	entries, err := backup.History(cfg)
 	if err != nil {
@@ -159,25 +520,292 @@ func runHistory(cfg *config.Config, reader *bufio.Reader) {
 		pause(reader)
 		return
 	}
-	fmt.Printf("Backup history (%d total):\n\n", len(entries))
-	fmt.Println("  When                  Size      Path")
-	fmt.Println("  --------------------  --------  ------------------------------------")
+	labels := backup.Classify(cfg, entries)
+	w := len(backup.ID(cfg, entries[0]))
+	var notes map[string]string // read on the first / filter
+	bySize, expiredOnly, filter, page := false, false, "", 0
+	for {
+		var shown []backup.HistoryEntry
+		for _, e := range entries {
+			if expiredOnly && labels[e.Path] != backup.KeepExpired {
+				continue
+			}
+			if filter != "" && !strings.Contains(strings.ToLower(notes[e.Path]), strings.ToLower(filter)) {
+				continue
+			}
+			shown = append(shown, e)
+		}
+		if bySize {
+			sort.SliceStable(shown, func(i, j int) bool { return shown[i].Size > shown[j].Size })
+		}
+		pages := max(1, (len(shown)+historyPageSize-1)/historyPageSize)
+		page = min(max(page, 0), pages-1)
+
+		fmt.Printf("Backup history (%d total", len(entries))
+		if len(shown) != len(entries) {
+			fmt.Printf(", %d shown", len(shown))
+		}
+		fmt.Print("):\n\n")
+		printBudget(cfg, entries)
+		fmt.Printf("  %-*s  When              Size      Keep     Replica  Path\n", w, "ID")
+		fmt.Printf("  %s  ----------------  --------  -------  -------  ------------------------------------\n", strings.Repeat("-", w))
+		for _, e := range shown[page*historyPageSize : min(len(shown), (page+1)*historyPageSize)] {
+			fmt.Printf("  %-*s  %-16s  %-8s  %-7s  %-7s  %s\n",
+				w, backup.ID(cfg, e),
+				e.When.Format("2006-01-02 15:04"),
+				backup.HumanSize(e.Size),
+				labels[e.Path],
+				replicaStatus(cfg, e),
+				e.Path)
+		}
+		view := "newest first"
+		if bySize {
+			view = "largest first"
+		}
+		if expiredOnly {
+			view += ", expired only"
+		}
+		if filter != "" {
+			view += fmt.Sprintf(", note contains %q", filter)
+		}
+		fmt.Printf("\nPage %d/%d, %s\n", page+1, pages, view)
+		fmt.Println("n/p = next/previous page, s = sort by date/size, e = expired only, /text = filter by note, / = clear filter")
+		if !cfg.ReadOnly {
+			fmt.Println("d <ID> = delete that backup, x <ID> [days] = keep it longer (default 30 days)")
+		}
+
+		ans := strings.TrimSpace(readLine(reader, "Enter to go back: "))
+		switch {
+		case ans == "" || isQuit(ans):
+			return
+		case ans == "n":
+			page++
+		case ans == "p":
+			page--
+		case ans == "s":
+			bySize, page = !bySize, 0
+		case ans == "e":
+			expiredOnly, page = !expiredOnly, 0
+		case strings.HasPrefix(ans, "d ") && !cfg.ReadOnly:
+			if !deleteFromHistory(cfg, reader, strings.TrimSpace(ans[2:])) {
+				continue
+			}
+			if entries, err = backup.History(cfg); err != nil || len(entries) == 0 {
+				return
+			}
+			labels = backup.Classify(cfg, entries)
+		case strings.HasPrefix(ans, "x ") && !cfg.ReadOnly:
+			f := strings.Fields(ans[2:])
+			days := 30
+			if len(f) == 0 {
+				fmt.Println("ERROR: x needs a backup ID")
+				continue
+			}
+			if len(f) > 1 {
+				if days, err = strconv.Atoi(f[1]); err != nil {
+					fmt.Println("ERROR: days must be a whole number")
+					continue
+				}
+			}
+			e, err := backup.Find(cfg, f[0])
+			if err != nil {
+				fmt.Println("ERROR:", err)
+				continue
+			}
+			release, err := lockBackupPath(cfg, "extend")
+			if err != nil {
+				fmt.Println("ERROR:", err)
+				continue
+			}
+			until, err := backup.Extend(cfg, e, days)
+			release()
+			if err != nil {
+				fmt.Println("ERROR:", err)
+				continue
+			}
+			fmt.Printf("%s is kept until %s.\n", backup.ID(cfg, e), until.Format("2006-01-02"))
+			if entries, err = backup.History(cfg); err != nil || len(entries) == 0 {
+				return
+			}
+			labels = backup.Classify(cfg, entries)
+		case strings.HasPrefix(ans, "/"):
+			filter, page = strings.TrimSpace(ans[1:]), 0
+			if filter != "" && notes == nil {
+				notes = map[string]string{}
+				for _, e := range entries {
+					if m, err := backup.ReadManifest(e); err == nil {
+						notes[e.Path] = m.Note
+					}
+				}
+			}
+		default:
+			fmt.Println("Unknown command:", ans)
+		}
+		fmt.Println()
+	}
+}
+
+// deleteFromHistory deletes one backup picked in the history view after
+// the usual confirmation. It reports whether anything was deleted.
+func deleteFromHistory(cfg *config.Config, reader *bufio.Reader, id string) bool {
+	e, err := backup.Find(cfg, id)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return false
+	}
+	fmt.Printf("%s  %s  %s\n", backup.ID(cfg, e), backup.HumanSize(e.Size), e.Path)
+	if !confirm(cfg, reader, "Delete this backup?", backup.ID(cfg, e)) {
+		fmt.Println("Cancelled.")
+		return false
+	}
+	if !ensureOperator(cfg, reader) {
+		return false
+	}
+	release, err := lockBackupPath(cfg, "delete")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return false
+	}
+	defer release()
+	logger.Info("delete confirmed %s", actor())
+	if err := backup.Delete(e); err != nil {
+		logger.Error("delete %s: %v", e.Path, err)
+		return false
+	}
+	fmt.Printf("Deleted %s, freed %s.\n", backup.ID(cfg, e), backup.HumanSize(e.Size))
+	return true
+}
+
+// stopTomcatFor stops Tomcat before a backup. If stopping fails it tries to
+// start Tomcat again so the service is never left half-down, and returns false.
+func stopTomcatFor(cfg *config.Config) bool {
+	timeout := time.Duration(cfg.TomcatTimeoutSeconds) * time.Second
+	status("Stopping Tomcat: %s\n", cfg.TomcatService)
+	logger.Info("tomcat stop %s", cfg.TomcatService)
+	if err := tomcat.Stop(cfg.TomcatService, timeout); err != nil {
+		logger.Error("tomcat stop failed, backup not started: %v", err)
+		startTomcatAfter(cfg)
+		return false
+	}
+	return true
+}
+
+// startTomcatAfter starts Tomcat after a backup, whatever its outcome.
+func startTomcatAfter(cfg *config.Config) {
+	timeout := time.Duration(cfg.TomcatTimeoutSeconds) * time.Second
+	status("Starting Tomcat: %s\n", cfg.TomcatService)
+	logger.Info("tomcat start %s", cfg.TomcatService)
+	if err := tomcat.Start(cfg.TomcatService, timeout); err != nil {
+		logger.Error("tomcat start failed, start it by hand: %v", err)
+	}
+}
+
+// replicateAfterBackup pushes the new backup, and any earlier ones still
+// queued because replica_path was unreachable, to replica_path. A failure
+// here never fails the backup itself; the copies stay queued for the next
+// run or `lifeboat sync`.
+func replicateAfterBackup(cfg *config.Config) {
+	release, err := lockBackupPath(cfg, "replicate")
+	if err != nil {
+		status("  Replica:   not copied: %v\n", err)
+		return
+	}
+	defer release()
+	ctx, done := cancellable()
+	defer done()
+	n, err := backup.Flush(ctx, cfg, func(e backup.HistoryEntry) {
+		status("Replicating %s to %s ...\n", backup.ID(cfg, e), backup.ReplicaPath(cfg, e))
+	})
+	if err != nil {
+		status("  Replica:   not copied, queued for the next run or `lifeboat sync`\n")
+		return
+	}
+	if n > 0 {
+		status("  Replica:   %d backup(s) copied to %s\n", n, cfg.ReplicaPath)
+	}
+}
+
+// cleanupAfterBackup deletes the expired backups once a backup succeeded,
+// when auto_cleanup is set. Setting it is the consent, so nothing is
+// asked, not even an operator name.
+func cleanupAfterBackup(cfg *config.Config) {
+	if !cfg.AutoCleanup || !cfg.CleanupEnabled() {
+		return
+	}
+	release, err := lockBackupPath(cfg, "cleanup")
+	if err != nil {
+		logger.Error("auto cleanup: %v", err)
+		return
+	}
+	defer release()
+	pruneLog(cfg)
+	logger.Info("cleanup confirmed auto_cleanup %s", actor())
+	deleted, freed, err := backup.Cleanup(cfg, false)
+	if err != nil {
+		logger.Error("auto cleanup: %v", err)
+		return
+	}
+	if len(deleted) > 0 {
+		status("  Cleanup:   %d expired backup(s) deleted, %s freed\n", len(deleted), backup.HumanSize(freed))
+	}
+}
+
+// replicaStatus is the Replica column of the history view.
+func replicaStatus(cfg *config.Config, e backup.HistoryEntry) string {
+	switch {
+	case cfg.ReplicaPath == "":
+		return "-"
+	case backup.IsReplicated(cfg, e):
+		return "yes"
+	default:
+		return "MISSING"
+	}
+}
+
+// notifyDone raises a desktop notification if desktop_notify is on.
+func notifyDone(cfg *config.Config, title, message string) {
+	if !cfg.DesktopNotify {
+		return
+	}
+	if err := notify.Desktop("Lifeboat: "+title, message); err != nil {
+		logger.Info("desktop notification not shown: %v", err)
+	}
+}
+
+// retentionRule describes the active retention rule for the menu.
+func retentionRule(cfg *config.Config) string {
+	if cfg.GFS() {
+		return fmt.Sprintf("keep %d daily, %d weekly, %d monthly", cfg.KeepDaily, cfg.KeepWeekly, cfg.KeepMonthly)
+	}
+	return fmt.Sprintf("older than %d days", cfg.RetentionDays)
+}
+
+// printBudget shows how much of the configured budget the backups use.
+func printBudget(cfg *config.Config, entries []backup.HistoryEntry) {
+	budget, _ := cfg.BudgetBytes()
+	if budget <= 0 {
+		return
+	}
+	var used int64
 	for _, e := range entries {
-		fmt.Printf("  %-20s  %-8s  %s\n",
-			e.When.Format("2006-01-02 15:04"),
-			backup.HumanSize(e.Size),
-			e.Path)
+		used += e.Size
 	}
-	pause(reader)
+	status := "OK"
+	if used > budget {
+		status = "EXCEEDED"
+	}
+	fmt.Printf("Budget: %s of %s used (%.1f%%) %s\n\n",
+		backup.HumanSize(used), backup.HumanSize(budget), float64(used)*100/float64(budget), status)
 }
 
 func runCleanup(cfg *config.Config, reader *bufio.Reader) {
-	if cfg.RetentionDays <= 0 {
+	pruneLog(cfg)
+	if !cfg.CleanupEnabled() {
 		fmt.Println("Retention disabled (retention_days = 0).")
 		pause(reader)
 		return
 	}
-	preview, freed, err := backup.Cleanup(cfg, true)
+	preview, _, err := backup.Cleanup(cfg, true)
 	if err != nil {
 		fmt.Println("ERROR:", err)
 		pause(reader)
@@ -185,55 +813,233 @@ func runCleanup(cfg *config.Config, reader *bufio.Reader) {
 	}
 	fmt.Println()
 	if len(preview) == 0 {
-		fmt.Printf("Nothing to delete. No backups older than %d days.\n", cfg.RetentionDays)
+		fmt.Printf("Nothing to delete. No backups expired (%s).\n", retentionRule(cfg))
 		pause(reader)
 		return
 	}
-	fmt.Printf("Backups older than %d days:\n\n", cfg.RetentionDays)
-	for _, e := range preview {
-		fmt.Printf("  %s  %-8s  %s\n",
+	fmt.Printf("Backups expired (%s):\n\n", retentionRule(cfg))
+	w := len(backup.ID(cfg, preview[0]))
+	for i, e := range preview {
+		fmt.Printf("  [%2d] %-*s  %s  %-8s  %s\n", i+1,
+			w, backup.ID(cfg, e),
 			e.When.Format("2006-01-02 15:04"),
 			backup.HumanSize(e.Size),
 			e.Path)
 	}
-	fmt.Printf("\nTotal space to free: %s\n\n", backup.HumanSize(freed))
+	fmt.Println()
 
-	ans := strings.ToLower(strings.TrimSpace(readLine(reader, "Delete these backups? (y/N): ")))
-	if ans != "y" && ans != "yes" {
+	input := strings.TrimSpace(readLine(reader, "Numbers to keep this time (e.g. 2,5  blank to delete all, q to cancel): "))
+	if isQuit(input) {
 		fmt.Println("Cancelled.")
 		pause(reader)
 		return
 	}
-	deleted, freed, err := backup.Cleanup(cfg, false)
+	spared, err := backup.ParseSelection(input, len(preview))
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		pause(reader)
+		return
+	}
+	skip := map[int]bool{}
+	for _, n := range spared {
+		skip[n-1] = true
+	}
+	var doomed []backup.HistoryEntry
+	var freed int64
+	for i, e := range preview {
+		if !skip[i] {
+			doomed = append(doomed, e)
+			freed += e.Size
+		}
+	}
+	if len(doomed) == 0 {
+		fmt.Println("Nothing to delete: every expired backup kept this time.")
+		pause(reader)
+		return
+	}
+	fmt.Printf("\n%d backup(s) to delete, %d kept this time.\n", len(doomed), len(spared))
+	fmt.Printf("Total space to free: %s\n", backup.HumanSize(freed))
+	if budget, _ := cfg.BudgetBytes(); budget > 0 {
+		if used, err := backup.Usage(cfg); err == nil {
+			fmt.Printf("Budget after cleanup: %s of %s\n", backup.HumanSize(used-freed), backup.HumanSize(budget))
+		}
+	}
+	fmt.Println()
+
+	if !confirm(cfg, reader, "Delete these backups?", "DELETE") {
+		fmt.Println("Cancelled.")
+		pause(reader)
+		return
+	}
+	if !ensureOperator(cfg, reader) {
+		pause(reader)
+		return
+	}
+	release, err := lockBackupPath(cfg, "cleanup")
 	if err != nil {
 		fmt.Println("ERROR:", err)
 		pause(reader)
 		return
 	}
-	fmt.Printf("\nDeleted %d backup(s), freed %s.\n", len(deleted), backup.HumanSize(freed))
+	defer release()
+	logger.Info("cleanup confirmed %s", actor())
+	if len(spared) > 0 {
+		logger.Info("cleanup kept %d expired backup(s) on request", len(spared))
+	}
+	deleted := 0
+	freed = 0
+	for i, e := range doomed {
+		fmt.Printf("  [%d/%d] Deleting %s ...\n", i+1, len(doomed), backup.ID(cfg, e))
+		if err := backup.Delete(e); err != nil {
+			logger.Error("delete %s: %v", e.Path, err)
+			continue
+		}
+		deleted++
+		freed += e.Size
+	}
+	fmt.Printf("\nDeleted %d backup(s), freed %s.\n", deleted, backup.HumanSize(freed))
 	pause(reader)
 }
 
+// pruneLog trims lifeboat.log to log_retention_days. It runs with every
+// cleanup so the log does not grow for years on a server nobody visits.
+func pruneLog(cfg *config.Config) {
+	if cfg.LogRetentionDays <= 0 {
+		return
+	}
+	n, err := logger.Prune(cfg.LogRetentionDays)
+	if err != nil {
+		status("WARN: could not trim log: %v\n", err)
+		return
+	}
+	if n > 0 {
+		status("Trimmed %d log line(s) older than %d days.\n", n, cfg.LogRetentionDays)
+		logger.Info("log trimmed lines=%d older_than_days=%d", n, cfg.LogRetentionDays)
+	}
+}
+
+// confirm asks before a destructive action, as strict as the confirmation
+// setting says: strict makes the user type phrase, normal asks y/N, off
+// does not ask at all.
+func confirm(cfg *config.Config, reader *bufio.Reader, question, phrase string) bool {
+	switch cfg.Confirmation {
+	case "off":
+		return true
+	case "strict":
+		ans := strings.TrimSpace(readLine(reader, fmt.Sprintf("%s Type %s to confirm (q to cancel): ", question, phrase)))
+		return ans == phrase
+	default:
+		ans := strings.ToLower(strings.TrimSpace(readLine(reader, question+" (y/N, q to cancel): ")))
+		return ans == "y" || ans == "yes"
+	}
+}
+
+// refuseReadOnly tells the user a mutating action is unavailable and returns
+// true when the session is read-only.
+func refuseReadOnly(cfg *config.Config, reader *bufio.Reader) bool {
+	if !cfg.ReadOnly {
+		return false
+	}
+	fmt.Println("Not available: lifeboat is running in read-only mode.")
+	logger.Info("refused mutating action in read-only mode %s", actor())
+	pause(reader)
+	return true
+}
+
+// printUsage lists the flags in fs except the hidden ones.
+func printUsage(fs *flag.FlagSet, hidden ...string) {
+	fmt.Fprintln(fs.Output(), "Usage: lifeboat [flags] [command]")
+	fmt.Fprintln(fs.Output(), "Commands: init, wizard, detect, validate [file], backup [--items A,B] [--stdout] [--dry-run], cleanup [--dry-run], logs [-n N] [--follow], history [--since YYYY-MM-DD] [--tag T], stats, health, search <text>, info <id>, drift <id>, export <id> --file F, import F, note <id> [text], tag <id> [a,b] [--remove], extend <id> --days N, delete <id>..., browse <id>, inspect <id> --peek <item>/<path>, manifest <id>, replicate <id>, sync, catalog push|pull <file>...|list, completion bash|zsh|fish|powershell")
+	fs.VisitAll(func(f *flag.Flag) {
+		for _, h := range hidden {
+			if f.Name == h {
+				return
+			}
+		}
+		fmt.Fprintf(fs.Output(), "  --%s\n    \t%s\n", f.Name, f.Usage)
+	})
+}
+
+// osUser returns the login name of the account running the process.
+func osUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return u.Username
+}
+
+// actor formats the session identity for log lines.
+func actor() string {
+	if session.operator == "" {
+		return fmt.Sprintf("user=%s", session.user)
+	}
+	return fmt.Sprintf("user=%s operator=%q", session.user, session.operator)
+}
+
+// ensureOperator asks for an operator name before a destructive action when
+// require_operator is set and --operator was not given. Returns false if the
+// user left it blank.
+func ensureOperator(cfg *config.Config, reader *bufio.Reader) bool {
+	if !cfg.RequireOperator || session.operator != "" {
+		return true
+	}
+	session.operator = strings.TrimSpace(readLine(reader, "Operator name/ID (required): "))
+	if session.operator == "" {
+		fmt.Println("Cancelled: an operator name is required (require_operator = true).")
+		return false
+	}
+	return true
+}
+
 func writeInitTemplate() error {
 	out := config.DefaultFile
 	if _, err := os.Stat(out); err == nil {
 		return fmt.Errorf("%s already exists", out)
 	}
-	content := config.Example("my-webapp", "")
-	if err := os.WriteFile(out, []byte(content), 0o644); err != nil {
+	s := config.Starter{
+		Name:          "my-webapp",
+		BackupPath:    ".",
+		Compression:   config.Default().Compression,
+		RetentionDays: 30,
+	}
+	// Prefill from the first Tomcat found; the rest are listed by `detect`.
+	installs := tomcat.Detect()
+	if len(installs) > 0 {
+		s.WebappsPath = installs[0].Webapps
+		conf := filepath.Join(installs[0].Home, "conf")
+		if fi, err := os.Stat(conf); err == nil && fi.IsDir() {
+			s.ExtraFolders = []string{conf}
+		}
+	}
+	if err := os.WriteFile(out, []byte(s.TOML()), 0o644); err != nil {
 		return err
 	}
 	abs, _ := filepath.Abs(out)
 	fmt.Println("Created:", abs)
+	if len(installs) > 0 {
+		fmt.Println("Prefilled webapps_path with", installs[0].Webapps)
+		if len(installs) > 1 {
+			fmt.Println("More Tomcats were found; `lifeboat detect` lists them.")
+		}
+		fmt.Println("Check the file and set name, then run `lifeboat`.")
+		return nil
+	}
 	fmt.Println("Edit the file and set name + webapps_path, then run `lifeboat`.")
 	return nil
 }
 
+// readLine prompts and returns one line of input. When input is closed
+// (end of a piped script, or Ctrl+Z/Ctrl+D) the session ends cleanly instead
+// of looping on empty answers.
 func readLine(r *bufio.Reader, prompt string) string {
 	fmt.Print(prompt)
 	line, err := r.ReadString('\n')
-	if err != nil {
-		return ""
+	if err != nil && line == "" {
+		fmt.Println()
+		logger.Info("input closed, session end %s", actor())
+		logger.Close()
+		os.Exit(0)
 	}
 	return strings.TrimRight(line, "\r\n")
 }
@@ -244,6 +1050,54 @@ func pause(r *bufio.Reader) {
 	_, _ = r.ReadString('\n')
 }
 
+// isQuit reports whether input is the "q to cancel" answer.
+func isQuit(input string) bool {
+	return strings.EqualFold(strings.TrimSpace(input), "q")
+}
+
+// interrupt routes Ctrl+C: it cancels the running operation if there is
+// one, otherwise it ends the session.
+var interrupt struct {
+	sync.Mutex
+	cancel context.CancelFunc
+}
+
+func watchInterrupts() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	go func() {
+		for range ch {
+			interrupt.Lock()
+			cancel := interrupt.cancel
+			interrupt.Unlock()
+			if cancel != nil {
+				fmt.Println("\nCancelling...")
+				cancel()
+				continue
+			}
+			fmt.Println("\nInterrupted. Goodbye.")
+			logger.Info("session interrupted %s", actor())
+			logger.Close()
+			os.Exit(130)
+		}
+	}()
+}
+
+// cancellable returns a context that Ctrl+C cancels, and a func to call
+// when the operation is over.
+func cancellable() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt.Lock()
+	interrupt.cancel = cancel
+	interrupt.Unlock()
+	return ctx, func() {
+		interrupt.Lock()
+		interrupt.cancel = nil
+		interrupt.Unlock()
+		cancel()
+	}
+}
+
 func clearScreen() {
 	// Simple cross-platform: emit a bunch of newlines. Avoids cmd/terminal
 	// specific escape sequences for Windows 2008 R2 compatibility.
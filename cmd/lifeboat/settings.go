@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// setting is one lifeboat.toml key the settings screen can change. parse
+// checks an answer and returns the value to write.
+type setting struct {
+	key   string
+	show  func(cfg *config.Config) string
+	parse func(ans string) (any, error)
+	apply func(cfg *config.Config, v any)
+}
+
+var settings = []setting{
+	{
+		key:  "webapps_path",
+		show: func(cfg *config.Config) string { return filepath.ToSlash(cfg.WebappsPath) },
+		parse: func(ans string) (any, error) {
+			if fi, err := os.Stat(ans); err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("not a folder: %s", ans)
+			}
+			abs, _ := filepath.Abs(ans)
+			return filepath.ToSlash(abs), nil
+		},
+		apply: func(cfg *config.Config, v any) { cfg.WebappsPath = filepath.FromSlash(v.(string)) },
+	},
+	{
+		key:  "retention_days",
+		show: func(cfg *config.Config) string { return strconv.Itoa(cfg.RetentionDays) },
+		parse: func(ans string) (any, error) {
+			n, err := strconv.Atoi(ans)
+			if err != nil || n < 0 {
+				return nil, errors.New("enter a whole number of days (0 = never delete)")
+			}
+			return n, nil
+		},
+		apply: func(cfg *config.Config, v any) { cfg.RetentionDays = v.(int) },
+	},
+	{
+		key:  "compression",
+		show: func(cfg *config.Config) string { return strconv.FormatBool(cfg.Compression) },
+		parse: func(ans string) (any, error) {
+			switch strings.ToLower(ans) {
+			case "y", "yes", "true":
+				return true, nil
+			case "n", "no", "false":
+				return false, nil
+			}
+			return nil, errors.New("answer y or n")
+		},
+		apply: func(cfg *config.Config, v any) { cfg.Compression = v.(bool) },
+	},
+	{
+		key: "extra_folders",
+		show: func(cfg *config.Config) string {
+			if len(cfg.ExtraFolders) == 0 {
+				return "none"
+			}
+			return filepath.ToSlash(strings.Join(cfg.ExtraFolders, ", "))
+		},
+		parse: func(ans string) (any, error) {
+			folders := []string{}
+			if strings.EqualFold(ans, "none") {
+				return folders, nil
+			}
+			for _, f := range strings.Split(ans, ",") {
+				if f = strings.TrimSpace(f); f == "" {
+					continue
+				}
+				if fi, err := os.Stat(f); err != nil || !fi.IsDir() {
+					return nil, fmt.Errorf("not a folder: %s", f)
+				}
+				abs, _ := filepath.Abs(f)
+				folders = append(folders, filepath.ToSlash(abs))
+			}
+			return folders, nil
+		},
+		apply: func(cfg *config.Config, v any) {
+			cfg.ExtraFolders = nil
+			for _, f := range v.([]string) {
+				cfg.ExtraFolders = append(cfg.ExtraFolders, filepath.FromSlash(f))
+			}
+		},
+	},
+}
+
+// runSettings shows the main lifeboat.toml settings and writes a changed
+// one back to the file, comments and all, so nobody has to hand-edit it
+// for the common changes. Everything else is still edited in the file.
+func runSettings(cfg *config.Config, reader *bufio.Reader, instance string) {
+	path, _ := filepath.Abs(config.DefaultFile)
+	for {
+		fmt.Println()
+		fmt.Println("Settings in", path)
+		fmt.Println()
+		for i, s := range settings {
+			fmt.Printf("  %d. %-15s %s\n", i+1, s.key, s.show(cfg))
+		}
+		fmt.Println()
+		switch {
+		case cfg.ReadOnly:
+			fmt.Println("Read-only mode: settings can be viewed, not changed.")
+			pause(reader)
+			return
+		case instance != "":
+			fmt.Printf("Running as instance %s: edit its [[instances]] entry in lifeboat.toml.\n", instance)
+			pause(reader)
+			return
+		}
+		ans := strings.TrimSpace(readLine(reader, fmt.Sprintf("Pick 1-%d to change, Enter to go back: ", len(settings))))
+		if ans == "" || isQuit(ans) {
+			return
+		}
+		n, err := strconv.Atoi(ans)
+		if err != nil || n < 1 || n > len(settings) {
+			fmt.Println("Invalid choice.")
+			continue
+		}
+		s := settings[n-1]
+		v, err := askSetting(reader, s, s.show(cfg))
+		if errors.Is(err, errCancelled) {
+			continue
+		}
+		if err := config.Update(path, map[string]any{s.key: v}); err != nil {
+			fmt.Println("ERROR: not saved:", err)
+			pause(reader)
+			continue
+		}
+		s.apply(cfg, v)
+		logger.Info("setting changed %s=%v %s", s.key, v, actor())
+		fmt.Println("Saved.")
+	}
+}
+
+// askSetting asks for a new value until it parses or the user types q.
+func askSetting(reader *bufio.Reader, s setting, current string) (any, error) {
+	for {
+		ans, err := ask(reader, "New "+s.key, current)
+		if err != nil {
+			return nil, err
+		}
+		v, err := s.parse(ans)
+		if err == nil {
+			return v, nil
+		}
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/tomcat"
+)
+
+var errCancelled = errors.New("cancelled")
+
+// runWizard asks the handful of questions a new install needs and writes
+// lifeboat.toml, so nobody has to hand-edit the `init` template.
+func runWizard(reader *bufio.Reader) error {
+	out := config.DefaultFile
+	if _, err := os.Stat(out); err == nil {
+		return fmt.Errorf("%s already exists", out)
+	}
+	fmt.Println("TTS Lifeboat setup. Press Enter to accept [defaults], q to cancel.")
+	fmt.Println()
+
+	installs := tomcat.Detect()
+	var home, webapps string
+	if len(installs) == 0 {
+		fmt.Println("No Tomcat found via CATALINA_HOME or the usual folders.")
+	} else {
+		fmt.Println("Tomcat installs found:")
+		for i, in := range installs {
+			fmt.Printf("  %d. %s  (%s)\n", i+1, in.Webapps, in.Source)
+		}
+	}
+	for webapps == "" {
+		prompt := "Path to the webapps folder: "
+		if len(installs) > 0 {
+			prompt = fmt.Sprintf("Pick 1-%d or type a webapps path [1]: ", len(installs))
+		}
+		ans := strings.TrimSpace(readLine(reader, prompt))
+		if isQuit(ans) {
+			return errCancelled
+		}
+		if ans == "" && len(installs) > 0 {
+			ans = "1"
+		}
+		if n, err := strconv.Atoi(ans); err == nil && n >= 1 && n <= len(installs) {
+			home, webapps = installs[n-1].Home, installs[n-1].Webapps
+			break
+		}
+		if fi, err := os.Stat(ans); err != nil || !fi.IsDir() {
+			fmt.Println("Not a folder:", ans)
+			continue
+		}
+		webapps, _ = filepath.Abs(ans)
+		home = filepath.Dir(webapps)
+	}
+
+	s := config.Starter{
+		Name:          filepath.Base(home),
+		BackupPath:    ".",
+		WebappsPath:   webapps,
+		Compression:   config.Default().Compression,
+		RetentionDays: 30,
+	}
+	var err error
+	if s.Name, err = ask(reader, "Project name", s.Name); err != nil {
+		return err
+	}
+	if s.BackupPath, err = ask(reader, "Backup folder (. = next to lifeboat.toml)", s.BackupPath); err != nil {
+		return err
+	}
+	yn := "n"
+	if s.Compression {
+		yn = "y"
+	}
+	if yn, err = ask(reader, "Compress backups into .tar.zst? (y/n)", yn); err != nil {
+		return err
+	}
+	s.Compression = strings.HasPrefix(strings.ToLower(yn), "y")
+	for {
+		days, err := ask(reader, "Delete backups older than how many days? (0 = never)", strconv.Itoa(s.RetentionDays))
+		if err != nil {
+			return err
+		}
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			s.RetentionDays = n
+			break
+		}
+		fmt.Println("Enter a whole number of days.")
+	}
+	conf := filepath.Join(home, "conf")
+	if fi, err := os.Stat(conf); err == nil && fi.IsDir() {
+		ans, err := ask(reader, "Also back up "+conf+"? (y/n)", "y")
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(strings.ToLower(ans), "y") {
+			s.ExtraFolders = []string{conf}
+		}
+	}
+
+	if err := os.WriteFile(out, []byte(s.TOML()), 0o644); err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(out)
+	fmt.Println()
+	fmt.Println("Created:", abs)
+	fmt.Println("Run `lifeboat` to start. Further settings are described in the file.")
+	return nil
+}
+
+// ask prompts with a default shown in brackets.
+func ask(reader *bufio.Reader, question, def string) (string, error) {
+	ans := strings.TrimSpace(readLine(reader, fmt.Sprintf("%s [%s]: ", question, def)))
+	if isQuit(ans) {
+		return "", errCancelled
+	}
+	if ans == "" {
+		return def, nil
+	}
+	return ans, nil
+}
@@ -4,6 +4,9 @@ package backup
 
 import (
 	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -48,27 +51,65 @@ func ListWebapps(cfg *config.Config) ([]Item, error) {
 	return items, nil
 }
 
-// Run executes a backup of the given items plus extra_folders from the config.
+// Run executes a backup of the given items plus extra_folders and database
+// dumps from the config.
 // Destination folder = <backup_path>/YYYYMMDD/HHMM.
-// Returns the destination path and total bytes copied.
-func Run(cfg *config.Config, items []Item, progress func(step, total int, name string)) (string, int64, error) {
+// Returns the destination path and total bytes copied. Cancelling ctx stops
+// the copy between (and inside) files. A backup that fails or is cancelled
+// removes its partial folder, so it never shows up as a restore point.
+func Run(ctx context.Context, cfg *config.Config, items []Item, progress func(step, total int, name string)) (dest string, bytes int64, err error) {
+	if cfg.MaxDurationMinutes > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.MaxDurationMinutes)*time.Minute)
+		defer cancel()
+	}
+	if err := waitForBackupPath(ctx, cfg); err != nil {
+		return "", 0, err
+	}
 	now := time.Now()
-	dest := filepath.Join(cfg.BackupPath, now.Format("20060102"), now.Format("1504"))
+	dest = filepath.Join(cfg.BackupPath, now.Format("20060102"), now.Format("1504"))
+	_, statErr := os.Stat(dest)
+	created := errors.Is(statErr, os.ErrNotExist)
 	if err := os.MkdirAll(dest, 0o755); err != nil {
 		return "", 0, err
 	}
+	defer func() {
+		if err == nil || !created {
+			return
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("backup exceeded max_duration_minutes (%d): %w", cfg.MaxDurationMinutes, err)
+			logger.Error("%v", err)
+		}
+		if ctx.Err() != nil {
+			logger.Info("backup cancelled, removing partial %s", dest)
+		} else {
+			logger.Info("backup failed, removing partial %s", dest)
+		}
+		_ = os.RemoveAll(dest)
+		if empty, _ := isEmpty(filepath.Dir(dest)); empty {
+			_ = os.Remove(filepath.Dir(dest))
+		}
+	}()
 	logger.Info("backup start dest=%s items=%d compression=%v", dest, len(items), cfg.Compression)
+	if Chaos.Enabled() {
+		logger.Info("chaos enabled fail-after=%d slow=%s disk-full=%v", Chaos.FailAfter, Chaos.SlowIO, Chaos.DiskFull)
+	}
 
-	total := len(items) + len(cfg.ExtraFolders)
-	var bytes int64
+	items, extras, release := readFromSnapshot(ctx, cfg, items, extraSources(cfg))
+	defer release()
+	total := len(items) + len(extras) + len(cfg.Databases)
 	step := 0
+	m := newManifest(cfg, now)
+	m.Note = backupNote(ctx, cfg)
+	meta := m.archiveMeta(cfg.IDPrefixExpanded() + now.Format("20060102-1504"))
 
 	for _, it := range items {
 		step++
 		if progress != nil {
 			progress(step, total, it.Name)
 		}
-		n, err := copyOne(it.Path, it.Name, dest, cfg.Compression)
+		n, err := copyItem(ctx, cfg, it.Path, it.Name, dest, m.recorder(it.Name), meta, webappKeep(cfg, it.Name))
 		if err != nil {
 			logger.Error("copy %s: %v", it.Name, err)
 			return dest, bytes, err
@@ -77,88 +118,233 @@ func Run(cfg *config.Config, items []Item, progress func(step, total int, name s
 		logger.Info("copied %s (%s)", it.Name, humanSize(n))
 	}
 
-	for _, folder := range cfg.ExtraFolders {
+	for _, x := range extras {
 		step++
-		name := filepath.Base(folder)
+		name := x.name
 		if progress != nil {
 			progress(step, total, name)
 		}
-		if _, err := os.Stat(folder); err != nil {
-			logger.Error("extra folder %s missing, skipping", folder)
+		if _, err := os.Stat(x.path); err != nil {
+			logger.Error("extra folder %s missing, skipping", x.path)
 			continue
 		}
-		n, err := copyOne(folder, name, dest, cfg.Compression)
+		n, err := copyItem(ctx, cfg, x.path, name, dest, m.recorder(name), meta, x.keep)
 		if err != nil {
-			logger.Error("copy extra %s: %v", folder, err)
+			logger.Error("copy extra %s: %v", x.path, err)
 			return dest, bytes, err
 		}
 		bytes += n
 		logger.Info("copied extra %s (%s)", name, humanSize(n))
 	}
 
+	for _, db := range cfg.Databases {
+		step++
+		if progress != nil {
+			progress(step, total, "db-"+db.Name)
+		}
+		n, err := dumpDatabase(ctx, cfg, db, dest, m, meta)
+		if err != nil {
+			logger.Error("%v", err)
+			return dest, bytes, err
+		}
+		bytes += n
+		logger.Info("dumped %s (%s)", db.Name, humanSize(n))
+	}
+
+	if err := writeManifest(dest, m); err != nil {
+		logger.Error("write manifest: %v", err)
+		return dest, bytes, err
+	}
 	logger.Info("backup done dest=%s size=%s", dest, humanSize(bytes))
 	return dest, bytes, nil
 }
 
+// waitForBackupPath retries until backup_path is reachable, backing off
+// from 2s up to 1 minute between tries, for at most wait_for_backup_path_minutes.
+// Only the final failure is reported as an error.
+func waitForBackupPath(ctx context.Context, cfg *config.Config) error {
+	_, err := os.Stat(cfg.BackupPath)
+	if err == nil || cfg.WaitMinutes <= 0 {
+		return err
+	}
+	deadline := time.Now().Add(time.Duration(cfg.WaitMinutes) * time.Minute)
+	delay := 2 * time.Second
+	for {
+		logger.Info("backup_path %s not reachable (%v), retrying in %s", cfg.BackupPath, err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if _, err = os.Stat(cfg.BackupPath); err == nil {
+			logger.Info("backup_path %s reachable", cfg.BackupPath)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			logger.Error("backup_path %s still not reachable after %d minute(s): %v", cfg.BackupPath, cfg.WaitMinutes, err)
+			return err
+		}
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+// copyItem runs copyOne under the per-item time limit, if any.
+func copyItem(ctx context.Context, cfg *config.Config, src, name, dest string, rec recordFunc, meta map[string]string, keep keepFunc) (int64, error) {
+	compress := cfg.Compression && !storeAsIs(cfg, src)
+	return withItemLimit(ctx, cfg, func(ctx context.Context) (int64, error) {
+		return copyOne(ctx, cfg, src, name, dest, compress, rec, meta, keep)
+	})
+}
+
+// withItemLimit runs copy under max_item_minutes, if set. Running out is
+// an error naming the setting; Run sees an ordinary error and removes the
+// partial folder.
+func withItemLimit(ctx context.Context, cfg *config.Config, copy func(context.Context) (int64, error)) (int64, error) {
+	if cfg.MaxItemMinutes <= 0 {
+		return copy(ctx)
+	}
+	itemCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.MaxItemMinutes)*time.Minute)
+	defer cancel()
+	n, err := copy(itemCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(itemCtx.Err(), context.DeadlineExceeded) {
+		return n, fmt.Errorf("exceeded max_item_minutes (%d): %w", cfg.MaxItemMinutes, err)
+	}
+	return n, err
+}
+
+// recordFunc is told about every file written, with its path relative to
+// the item and its SHA-256 (empty for links). nil means nobody listens.
+type recordFunc func(rel string, fi os.FileInfo, sum, link string)
+
+func (r recordFunc) add(rel string, fi os.FileInfo, sum, link string) {
+	if r != nil {
+		r(filepath.ToSlash(rel), fi, sum, link)
+	}
+}
+
+// storeAsIs reports whether src is a single file with one of the
+// store_extensions. Those are already compressed (.war, .jar, .zip), so
+// running them through zstd costs time and saves nothing.
+func storeAsIs(cfg *config.Config, src string) bool {
+	if !storeExt(cfg.StoreExtensions, src) {
+		return false
+	}
+	fi, err := os.Stat(src)
+	return err == nil && !fi.IsDir()
+}
+
 // copyOne copies a file or directory into dest, optionally as a .tar.zst archive.
 // Returns bytes of original data read.
-func copyOne(src, name, dest string, compress bool) (int64, error) {
+func copyOne(ctx context.Context, cfg *config.Config, src, name, dest string, compress bool, rec recordFunc, meta map[string]string, keep keepFunc) (int64, error) {
 	info, err := os.Stat(src)
 	if err != nil {
 		return 0, err
 	}
 	if compress {
 		target := filepath.Join(dest, name+".tar.zst")
-		return writeTarZst(src, target)
+		return writeTarZst(ctx, src, target, cfg.StoreExtensions, rec, meta, keep)
 	}
 	if info.IsDir() {
-		return copyDir(src, filepath.Join(dest, name))
+		return copyDir(ctx, src, filepath.Join(dest, name), rec, keep, true)
 	}
-	return copyFile(src, filepath.Join(dest, name))
+	n, sum, err := copyFile(ctx, src, filepath.Join(dest, name))
+	if err == nil {
+		rec.add(name, info, sum, "")
+	}
+	return n, err
 }
 
-func copyFile(src, dst string) (int64, error) {
+// copyFile copies src to dst and returns the bytes copied and their SHA-256.
+func copyFile(ctx context.Context, src, dst string) (int64, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
+	if err := chaosBeforeFile(src); err != nil {
+		return 0, "", err
+	}
 	in, err := os.Open(src)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	defer in.Close()
 	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	out, err := os.Create(dst)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	defer out.Close()
-	return io.Copy(out, in)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(chaosWriter(out), h), ctxReader{ctx, in})
+	return n, hex.EncodeToString(h.Sum(nil)), err
 }
 
-func copyDir(src, dst string) (int64, error) {
+// copyDir copies the tree at src to dst, walked as walkItem does with
+// follow.
+func copyDir(ctx context.Context, src, dst string, rec recordFunc, keep keepFunc, follow bool) (int64, error) {
 	var total int64
-	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		rel, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
+	var links hardLinks
+	err := walkItem(src, follow, func(path, rel string, info os.FileInfo) error {
+		if rel != "." && !keep.keep(rel, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 		target := filepath.Join(dst, rel)
 		if info.IsDir() {
 			return os.MkdirAll(target, info.Mode()|0o755)
 		}
-		n, err := copyFile(path, target)
+		if isLink(info) {
+			link, err := copyLink(path, target, follow)
+			if err != nil {
+				return fmt.Errorf("link %s not copied: %w", path, err)
+			}
+			rec.add(rel, info, "", filepath.ToSlash(link))
+			return nil
+		}
+		seen, dup := links.first(info, filepath.ToSlash(rel))
+		if dup {
+			if err := os.Link(filepath.Join(dst, filepath.FromSlash(seen.name)), target); err == nil {
+				rec.add(rel, info, seen.sum, seen.name)
+				return nil
+			}
+		}
+		n, sum, err := copyFile(ctx, path, target)
 		if err != nil {
 			return err
 		}
+		if !dup {
+			seen.sum = sum
+		}
+		rec.add(rel, info, sum, "")
 		total += n
 		return nil
 	})
 	return total, err
 }
 
-func writeTarZst(src, archive string) (int64, error) {
+// encoderThreads is compression_threads; 0 leaves it to zstd, which uses
+// every core.
+var encoderThreads int
+
+// SetCompressionThreads limits how many cores zstd uses. 0 = all.
+func SetCompressionThreads(n int) { encoderThreads = n }
+
+func newZstdWriter(w io.Writer) (*zstd.Encoder, error) {
+	if encoderThreads > 0 {
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(encoderThreads))
+	}
+	return zstd.NewWriter(w)
+}
+
+// writeTarZst archives src into archive, files with one of the store
+// extensions only stored (see tarZst). meta goes into a PAX global header
+// first, so an archive found on its own still says where it is from.
+func writeTarZst(ctx context.Context, src, archive string, store []string, rec recordFunc, meta map[string]string, keep keepFunc) (int64, error) {
 	if err := os.MkdirAll(filepath.Dir(archive), 0o755); err != nil {
 		return 0, err
 	}
@@ -168,15 +354,35 @@ func writeTarZst(src, archive string) (int64, error) {
 	}
 	defer out.Close()
 
-	zw, err := zstd.NewWriter(out)
+	tw, err := newTarZst(chaosWriter(out), store)
 	if err != nil {
 		return 0, err
 	}
-	defer zw.Close()
-
-	tw := tar.NewWriter(zw)
 	defer tw.Close()
+	if len(meta) > 0 {
+		hdr := &tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: meta}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return 0, err
+		}
+	}
 
+	total, err := writeTree(ctx, tw, src, "", rec, keep, true)
+	if err != nil {
+		return total, err
+	}
+	// Close explicitly: a full disk often only shows up here and must fail
+	// the backup instead of leaving a truncated archive.
+	if err := tw.Close(); err != nil {
+		return total, err
+	}
+	return total, out.Close()
+}
+
+// writeTree adds src (a file or a directory tree) to tw. With a prefix,
+// entries are stored under prefix/ (a single file as prefix itself), so
+// several items can share one archive. The tree is walked as walkItem does
+// with follow.
+func writeTree(ctx context.Context, tw *tarZst, src, prefix string, rec recordFunc, keep keepFunc, follow bool) (int64, error) {
 	info, err := os.Stat(src)
 	if err != nil {
 		return 0, err
@@ -184,30 +390,72 @@ func writeTarZst(src, archive string) (int64, error) {
 
 	var total int64
 	if !info.IsDir() {
-		n, err := addFileToTar(tw, src, filepath.Base(src))
+		name := filepath.Base(src)
+		if prefix != "" {
+			name = prefix
+		}
+		if err := tw.use(src); err != nil {
+			return 0, err
+		}
+		n, sum, err := addFileToTar(ctx, tw.Writer, src, name)
+		if err == nil {
+			rec.add(filepath.Base(src), info, sum, "")
+		}
 		return n, err
 	}
 
-	err = filepath.Walk(src, func(path string, fi os.FileInfo, werr error) error {
-		if werr != nil {
-			return werr
-		}
-		rel, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
-		}
+	var links hardLinks
+	err = walkItem(src, follow, func(path, rel string, fi os.FileInfo) error {
 		if rel == "." {
 			return nil
 		}
+		if !keep.keep(rel, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		if prefix != "" {
+			name = prefix + "/" + name
+		}
+		if isLink(fi) {
+			hdr, err := linkHeader(path, name, fi, follow)
+			if err != nil {
+				return fmt.Errorf("link %s not archived: %w", path, err)
+			}
+			rec.add(rel, fi, "", hdr.Linkname)
+			return tw.WriteHeader(hdr)
+		}
 		hdr, err := tar.FileInfoHeader(fi, "")
 		if err != nil {
 			return err
 		}
-		hdr.Name = filepath.ToSlash(rel)
+		hdr.Name = name
 		if fi.IsDir() {
 			hdr.Name += "/"
 			return tw.WriteHeader(hdr)
 		}
+		seen, dup := links.first(fi, filepath.ToSlash(rel))
+		if dup {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = seen.name
+			if prefix != "" {
+				hdr.Linkname = prefix + "/" + seen.name
+			}
+			hdr.Size = 0
+			rec.add(rel, fi, seen.sum, seen.name)
+			return tw.WriteHeader(hdr)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := chaosBeforeFile(path); err != nil {
+			return err
+		}
+		if err := tw.use(path); err != nil {
+			return err
+		}
 		if err := tw.WriteHeader(hdr); err != nil {
 			return err
 		}
@@ -215,36 +463,44 @@ func writeTarZst(src, archive string) (int64, error) {
 		if err != nil {
 			return err
 		}
-		n, err := io.Copy(tw, in)
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(tw, h), ctxReader{ctx, in})
 		in.Close()
 		if err != nil {
 			return err
 		}
+		seen.sum = hex.EncodeToString(h.Sum(nil))
+		rec.add(rel, fi, seen.sum, "")
 		total += n
 		return nil
 	})
 	return total, err
 }
 
-func addFileToTar(tw *tar.Writer, path, name string) (int64, error) {
+func addFileToTar(ctx context.Context, tw *tar.Writer, path, name string) (int64, string, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	hdr, err := tar.FileInfoHeader(fi, "")
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	hdr.Name = name
+	if err := chaosBeforeFile(path); err != nil {
+		return 0, "", err
+	}
 	if err := tw.WriteHeader(hdr); err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	defer f.Close()
-	return io.Copy(tw, f)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, h), ctxReader{ctx, f})
+	return n, hex.EncodeToString(h.Sum(nil)), err
 }
 
 // HistoryEntry describes one past backup directory.
@@ -252,12 +508,20 @@ type HistoryEntry struct {
 	Path string
 	When time.Time
 	Size int64
+	// KeepUntil is set when `lifeboat extend` holds the backup past the
+	// retention rules (see HoldFile).
+	KeepUntil time.Time
 }
 
 // History walks <backup_path>/YYYYMMDD/HHMM and returns entries newest first.
 func History(cfg *config.Config) ([]HistoryEntry, error) {
+	return historyIn(cfg.BackupPath)
+}
+
+// historyIn lists the YYYYMMDD/HHMM backup folders under root.
+func historyIn(root string) ([]HistoryEntry, error) {
 	var entries []HistoryEntry
-	dayEntries, err := os.ReadDir(cfg.BackupPath)
+	dayEntries, err := os.ReadDir(root)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return entries, nil
@@ -268,7 +532,7 @@ func History(cfg *config.Config) ([]HistoryEntry, error) {
 		if !day.IsDir() || !isDayFolder(day.Name()) {
 			continue
 		}
-		dayPath := filepath.Join(cfg.BackupPath, day.Name())
+		dayPath := filepath.Join(root, day.Name())
 		subs, err := os.ReadDir(dayPath)
 		if err != nil {
 			continue
@@ -283,9 +547,10 @@ func History(cfg *config.Config) ([]HistoryEntry, error) {
 				continue
 			}
 			entries = append(entries, HistoryEntry{
-				Path: full,
-				When: when,
-				Size: dirSize(full),
+				Path:      full,
+				When:      when,
+				Size:      dirSize(full),
+				KeepUntil: readHold(full),
 			})
 		}
 	}
@@ -293,21 +558,81 @@ func History(cfg *config.Config) ([]HistoryEntry, error) {
 	return entries, nil
 }
 
-// Cleanup deletes history entries older than retention_days.
+// Usage returns the total size of all backups under backup_path.
+func Usage(cfg *config.Config) (int64, error) {
+	entries, err := History(cfg)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	return total, nil
+}
+
+// CheckBudget logs an error when backups exceed the configured budget.
+// Returns whether the budget is exceeded.
+func CheckBudget(cfg *config.Config) bool {
+	budget, _ := cfg.BudgetBytes()
+	if budget <= 0 {
+		return false
+	}
+	used, err := Usage(cfg)
+	if err != nil {
+		return false
+	}
+	if used <= budget {
+		return false
+	}
+	logger.Error("budget exceeded for %s: %s used of %s (%.0f%%)",
+		cfg.Name, humanSize(used), humanSize(budget), percent(used, budget))
+	return true
+}
+
+// BudgetPreflight refuses a new backup when enforce_budget is on and the
+// existing backups already use the whole budget. Cleanup of expired backups
+// is the way out, so the error says so.
+func BudgetPreflight(cfg *config.Config) error {
+	budget, _ := cfg.BudgetBytes()
+	if !cfg.EnforceBudget || budget <= 0 {
+		return nil
+	}
+	used, err := Usage(cfg)
+	if err != nil {
+		return err
+	}
+	if used < budget {
+		return nil
+	}
+	err = fmt.Errorf("budget full: %s used of %s; run cleanup or raise budget before backing up",
+		humanSize(used), humanSize(budget))
+	logger.Error("backup refused for %s: %v", cfg.Name, err)
+	return err
+}
+
+func percent(n, of int64) float64 {
+	if of <= 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(of)
+}
+
+// Cleanup deletes history entries the retention rules expire (see Classify).
 // If dryRun is true nothing is removed. Returns deleted entries and bytes freed.
 func Cleanup(cfg *config.Config, dryRun bool) ([]HistoryEntry, int64, error) {
-	if cfg.RetentionDays <= 0 {
+	if !cfg.CleanupEnabled() {
 		return nil, 0, nil
 	}
 	entries, err := History(cfg)
 	if err != nil {
 		return nil, 0, err
 	}
-	cutoff := time.Now().AddDate(0, 0, -cfg.RetentionDays)
+	labels := Classify(cfg, entries)
 	var deleted []HistoryEntry
 	var freed int64
 	for _, e := range entries {
-		if !e.When.Before(cutoff) {
+		if labels[e.Path] != KeepExpired {
 			continue
 		}
 		deleted = append(deleted, e)
@@ -315,19 +640,28 @@ func Cleanup(cfg *config.Config, dryRun bool) ([]HistoryEntry, int64, error) {
 		if dryRun {
 			continue
 		}
-		if err := os.RemoveAll(e.Path); err != nil {
+		if err := Delete(e); err != nil {
 			logger.Error("delete %s: %v", e.Path, err)
-			continue
-		}
-		logger.Info("deleted old backup %s (%s)", e.Path, humanSize(e.Size))
-		parent := filepath.Dir(e.Path)
-		if empty, _ := isEmpty(parent); empty {
-			_ = os.Remove(parent)
 		}
 	}
 	return deleted, freed, nil
 }
 
+// Delete removes one backup folder, and its date folder once that is
+// empty. Used by Cleanup, and by the menu when the user picked which of
+// the expired backups go.
+func Delete(e HistoryEntry) error {
+	if err := os.RemoveAll(e.Path); err != nil {
+		return err
+	}
+	logger.Info("deleted old backup %s (%s)", e.Path, humanSize(e.Size))
+	parent := filepath.Dir(e.Path)
+	if empty, _ := isEmpty(parent); empty {
+		_ = os.Remove(parent)
+	}
+	return nil
+}
+
 func isDayFolder(name string) bool {
 	if len(name) != 8 {
 		return false
@@ -352,6 +686,22 @@ func isEmpty(dir string) (bool, error) {
 	return len(es) == 0, nil
 }
 
+// ctxReader fails reads once ctx is cancelled so a long io.Copy of a big
+// file stops promptly on Ctrl+C. It also applies the throttle.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	throttleWait(c.ctx, n)
+	return n, err
+}
+
 func dirSize(path string) int64 {
 	var n int64
 	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
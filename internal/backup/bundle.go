@@ -0,0 +1,240 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/kannan/tts-lifeboat/internal/app"
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// A bundle is one backup folder packed into a single .tar.zst for moving
+// it to another server (prod -> staging). Its first entry is
+// bundleMetaFile; the folder's contents follow under backup/.
+const (
+	bundleMetaFile = "lifeboat-bundle.json"
+	bundlePrefix   = "backup"
+)
+
+// BundleMeta describes the backup inside a bundle.
+type BundleMeta struct {
+	ID       string    `json:"id"`
+	Folder   string    `json:"folder"` // "YYYYMMDD/HHMM", where import puts it
+	Name     string    `json:"name"`
+	Host     string    `json:"host"`
+	Version  string    `json:"lifeboat_version"`
+	Exported time.Time `json:"exported"`
+}
+
+// Export writes backup e to w as a bundle and returns the bytes packed.
+// A lifeboat extend hold is left behind: it belongs to this server.
+func Export(ctx context.Context, cfg *config.Config, e HistoryEntry, w io.Writer) (int64, error) {
+	host, _ := os.Hostname()
+	meta := BundleMeta{
+		ID:       ID(cfg, e),
+		Folder:   e.When.Format("20060102/1504"),
+		Name:     cfg.Name,
+		Host:     host,
+		Version:  app.Version,
+		Exported: time.Now(),
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	// The backup's own archives and manifest are compressed already.
+	tw, err := newTarZst(w, append([]string{".zst", ".gz"}, cfg.StoreExtensions...))
+	if err != nil {
+		return 0, err
+	}
+	defer tw.Close()
+	hdr := &tar.Header{Name: bundleMetaFile, Mode: 0o644, Size: int64(len(data)), ModTime: meta.Exported}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return 0, err
+	}
+	skipHold := func(rel string, fi os.FileInfo) bool { return rel != HoldFile }
+	n, err := writeTree(ctx, tw, e.Path, bundlePrefix, nil, skipHold, false)
+	if err != nil {
+		return n, err
+	}
+	if err := tw.Close(); err != nil {
+		return n, err
+	}
+	logger.Info("exported %s (%s)", e.Path, humanSize(n))
+	return n, nil
+}
+
+// Import unpacks a bundle from r into backup_path under the folder it came
+// from, so it shows up in history like a local backup. An existing backup
+// at that time is never overwritten. The backup is unpacked next to its
+// final place first, checked against its manifest, and only then moved in.
+func Import(ctx context.Context, cfg *config.Config, r io.Reader) (HistoryEntry, BundleMeta, error) {
+	var meta BundleMeta
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return HistoryEntry{}, meta, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleMetaFile {
+		return HistoryEntry{}, meta, errors.New("not a lifeboat bundle")
+	}
+	if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+		return HistoryEntry{}, meta, fmt.Errorf("not a lifeboat bundle: %w", err)
+	}
+	when, err := time.ParseInLocation("20060102/1504", meta.Folder, time.Local)
+	if err != nil {
+		return HistoryEntry{}, meta, fmt.Errorf("bundle names a bad folder %q", meta.Folder)
+	}
+	dest := filepath.Join(cfg.BackupPath, filepath.FromSlash(meta.Folder))
+	if _, err := os.Stat(dest); err == nil {
+		return HistoryEntry{}, meta, fmt.Errorf("a backup already exists at %s; delete it first to import this one", dest)
+	}
+	tmp := filepath.Join(cfg.BackupPath, fmt.Sprintf(".import-%d", os.Getpid()))
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return HistoryEntry{}, meta, err
+	}
+	defer os.RemoveAll(tmp)
+
+	seen := map[string]bool{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return HistoryEntry{}, meta, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return HistoryEntry{}, meta, err
+		}
+		if err := unpackEntry(tr, hdr, tmp, seen); err != nil {
+			return HistoryEntry{}, meta, err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmp, ManifestFile)); err == nil {
+		if _, err := Verify(HistoryEntry{Path: tmp}); err != nil {
+			return HistoryEntry{}, meta, fmt.Errorf("bundle does not match its manifest: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return HistoryEntry{}, meta, err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return HistoryEntry{}, meta, err
+	}
+	e := HistoryEntry{Path: dest, When: when, Size: dirSize(dest)}
+	logger.Info("imported backup %s from %s (%s) to %s", meta.ID, meta.Host, humanSize(e.Size), dest)
+	return e, meta, nil
+}
+
+// bundlePath maps a bundle entry name to its place under root, refusing
+// names that would land outside it.
+func bundlePath(root, name string) (string, error) {
+	rel, ok := strings.CutPrefix(path.Clean(name), bundlePrefix+"/")
+	if !ok || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return "", fmt.Errorf("bundle entry %q is outside the backup", name)
+	}
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
+
+// unpackEntry writes one tar entry to its place under root. seen holds
+// the places written so far: a bundle naming one twice is refused, as is
+// an entry landing on something already there, which could be a symlink
+// unpacked earlier that writing would follow out of root.
+func unpackEntry(tr *tar.Reader, hdr *tar.Header, root string, seen map[string]bool) error {
+	target, err := bundlePath(root, hdr.Name)
+	if err != nil {
+		return err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir, tar.TypeSymlink, tar.TypeLink, tar.TypeReg:
+	default:
+		return nil
+	}
+	if seen[target] {
+		return fmt.Errorf("bundle entry %q appears twice", hdr.Name)
+	}
+	seen[target] = true
+	if fi, err := os.Lstat(target); err == nil && (hdr.Typeflag != tar.TypeDir || !fi.IsDir()) {
+		return fmt.Errorf("bundle entry %q: %s exists already", hdr.Name, target)
+	}
+	dir := target
+	if hdr.Typeflag != tar.TypeDir {
+		dir = filepath.Dir(target)
+	}
+	// A symlink unpacked earlier must not carry later entries out of root,
+	// so the part of dir that exists already is checked before creating
+	// the rest.
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil || existing == root {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if err := insideRoot(root, existing); err != nil {
+		return fmt.Errorf("bundle entry %q: %w", hdr.Name, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeLink:
+		first, err := bundlePath(root, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		return os.Link(first, target)
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode).Perm()|0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+	return nil
+}
+
+// insideRoot checks that dir, with symlinks resolved, is root or below it.
+func insideRoot(root, dir string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(realRoot, realDir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.New("leads outside the backup")
+	}
+	return nil
+}
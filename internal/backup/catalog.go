@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// Catalog collects backup metadata from many servers in one JSON file,
+// usually on a shared drive, so one machine can see every instance's
+// backups. It holds no backup data.
+type Catalog struct {
+	Entries []CatalogEntry `json:"entries"`
+}
+
+// CatalogEntry is one instance on one host as of its last push.
+type CatalogEntry struct {
+	Host       string          `json:"host"`
+	Instance   string          `json:"instance"`
+	BackupPath string          `json:"backup_path"`
+	Updated    time.Time       `json:"updated"`
+	Backups    []CatalogBackup `json:"backups"` // newest first
+}
+
+// CatalogBackup is one backup as listed in the catalog.
+type CatalogBackup struct {
+	ID   string    `json:"id"`
+	When time.Time `json:"when"`
+	Size int64     `json:"size"`
+}
+
+// Latest returns the entry's newest backup, if it has any.
+func (e CatalogEntry) Latest() (CatalogBackup, bool) {
+	if len(e.Backups) == 0 {
+		return CatalogBackup{}, false
+	}
+	return e.Backups[0], true
+}
+
+// CatalogEntryFor lists this machine's backups for cfg.
+func CatalogEntryFor(cfg *config.Config) (CatalogEntry, error) {
+	entries, err := History(cfg)
+	if err != nil {
+		return CatalogEntry{}, err
+	}
+	host, _ := os.Hostname()
+	ce := CatalogEntry{Host: host, Instance: cfg.Name, BackupPath: cfg.BackupPath, Updated: time.Now()}
+	for _, e := range entries {
+		ce.Backups = append(ce.Backups, CatalogBackup{ID: ID(cfg, e), When: e.When, Size: e.Size})
+	}
+	return ce, nil
+}
+
+// ReadCatalog loads the catalog at path. A missing file is an empty
+// catalog.
+func ReadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Catalog{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("read catalog %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Merge adds e, replacing an older entry for the same host and instance.
+// Reports whether the catalog changed.
+func (c *Catalog) Merge(e CatalogEntry) bool {
+	for i, old := range c.Entries {
+		if old.Host == e.Host && old.Instance == e.Instance {
+			if !e.Updated.After(old.Updated) {
+				return false
+			}
+			c.Entries[i] = e
+			return true
+		}
+	}
+	c.Entries = append(c.Entries, e)
+	return true
+}
+
+// UpdateCatalog applies change to the catalog at path and writes it back.
+// A lock file next to it keeps servers pushing at the same moment from
+// overwriting each other's entries.
+func UpdateCatalog(path string, change func(c *Catalog)) error {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	c, err := ReadCatalog(path)
+	if err != nil {
+		return err
+	}
+	change(c)
+	sort.Slice(c.Entries, func(i, j int) bool {
+		if c.Entries[i].Host != c.Entries[j].Host {
+			return c.Entries[i].Host < c.Entries[j].Host
+		}
+		return c.Entries[i].Instance < c.Entries[j].Instance
+	})
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// lockFile creates path exclusively, waiting up to 30 seconds for another
+// holder. A lock older than two minutes is left over from a crash and is
+// taken over.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > 2*time.Minute {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is held by another lifeboat; remove it if none is running", path)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
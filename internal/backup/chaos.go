@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// ChaosSettings injects fake failures so teams can rehearse their
+// backup-failure runbooks and check that alerting fires. The zero value
+// is off. Only reachable through the hidden --chaos flag.
+type ChaosSettings struct {
+	FailAfter int           // fail once this many files were written (0 = off)
+	SlowIO    time.Duration // sleep before every file
+	DiskFull  bool          // every write fails with "no space left on device"
+}
+
+// Chaos is the active failure-injection setting for this process.
+var Chaos ChaosSettings
+
+var chaosFiles int
+
+var errChaosDiskFull = errors.New("chaos: no space left on device")
+
+// ParseChaos reads "fail-after=N,slow=DURATION,disk-full".
+func ParseChaos(spec string) (ChaosSettings, error) {
+	var c ChaosSettings
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(part, "=")
+		switch key {
+		case "fail-after":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return c, fmt.Errorf("chaos: invalid fail-after %q", val)
+			}
+			c.FailAfter = n
+		case "slow":
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return c, fmt.Errorf("chaos: invalid slow %q", val)
+			}
+			c.SlowIO = d
+		case "disk-full":
+			c.DiskFull = true
+		default:
+			return c, fmt.Errorf("chaos: unknown option %q", key)
+		}
+	}
+	return c, nil
+}
+
+// Enabled reports whether any failure injection is configured.
+func (c ChaosSettings) Enabled() bool {
+	return c.FailAfter > 0 || c.SlowIO > 0 || c.DiskFull
+}
+
+// chaosBeforeFile is called before each file is written.
+func chaosBeforeFile(name string) error {
+	if !Chaos.Enabled() {
+		return nil
+	}
+	if Chaos.SlowIO > 0 {
+		time.Sleep(Chaos.SlowIO)
+	}
+	chaosFiles++
+	if Chaos.FailAfter > 0 && chaosFiles > Chaos.FailAfter {
+		logger.Info("chaos: injected failure at %s after %d files", name, Chaos.FailAfter)
+		return fmt.Errorf("chaos: injected failure after %d files", Chaos.FailAfter)
+	}
+	return nil
+}
+
+// chaosWriter wraps w so writes fail when disk-full is simulated.
+func chaosWriter(w io.Writer) io.Writer {
+	if !Chaos.DiskFull {
+		return w
+	}
+	return diskFullWriter{}
+}
+
+type diskFullWriter struct{}
+
+func (diskFullWriter) Write([]byte) (int, error) { return 0, errChaosDiskFull }
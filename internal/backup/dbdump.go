@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// dumpDatabase runs db.Command and stores its output as the single-file
+// item db-<name>.sql, archived like any other item. The dump is written to
+// a scratch folder inside dest first so a failed dump never leaves a
+// half-written file among the finished items.
+func dumpDatabase(ctx context.Context, cfg *config.Config, db config.Database, dest string, m *Manifest, meta map[string]string) (int64, error) {
+	name := "db-" + db.Name + ".sql"
+	scratch := filepath.Join(dest, ".dump")
+	if err := os.MkdirAll(scratch, 0o755); err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(scratch)
+
+	file := filepath.Join(scratch, name)
+	if err := runDump(ctx, db, file); err != nil {
+		return 0, err
+	}
+	return copyItem(ctx, cfg, file, name, dest, m.recorder(name), meta, nil)
+}
+
+// runDump runs db.Command with its output going to file.
+func runDump(ctx context.Context, db config.Database, file string) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, db.Command[0], db.Command[1:]...)
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	logger.Info("dump %s start: %s", db.Name, strings.Join(db.Command, " "))
+	err = cmd.Run()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("dump %s: %w: %s", db.Name, err, lastLine(msg))
+		}
+		return fmt.Errorf("dump %s: %w", db.Name, err)
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
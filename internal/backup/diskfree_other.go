@@ -0,0 +1,15 @@
+//go:build !windows
+
+package backup
+
+import "syscall"
+
+// diskFree returns the bytes available to this user on the volume holding
+// path.
+func diskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
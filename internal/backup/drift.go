@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// Drift kinds.
+const (
+	DriftAdded   = "added"
+	DriftChanged = "changed"
+	DriftDeleted = "deleted"
+)
+
+// Change is one difference between a backup and the live files.
+type Change struct {
+	Path string `json:"path"` // "<item>/<path inside item>", as in the manifest
+	Kind string `json:"kind"`
+}
+
+// Drift compares the manifest of e with what the same webapps and folders
+// hold now, using the filters a backup would apply. A file whose size and
+// modification time match is taken as unchanged; otherwise its SHA-256
+// decides. Only items in the backup are compared, so a webapp deployed
+// since is not reported; database dumps are skipped.
+func Drift(cfg *config.Config, e HistoryEntry) ([]Change, error) {
+	m, err := ReadManifest(e)
+	if err != nil {
+		return nil, fmt.Errorf("no manifest to compare with: %w", err)
+	}
+	live := map[string]source{}
+	items, err := ListWebapps(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		live[it.Name] = source{name: it.Name, path: it.Path, keep: webappKeep(cfg, it.Name)}
+	}
+	for _, x := range extraSources(cfg) {
+		live[x.name] = x
+	}
+
+	byItem := map[string][]FileEntry{}
+	for _, f := range m.Files {
+		item, _, _ := strings.Cut(f.Path, "/")
+		byItem[item] = append(byItem[item], f)
+	}
+	var out []Change
+	for item, files := range byItem {
+		if strings.HasPrefix(item, "db-") && strings.HasSuffix(item, ".sql") {
+			continue
+		}
+		src, ok := live[item]
+		if !ok {
+			out = append(out, Change{Path: item, Kind: DriftDeleted})
+			continue
+		}
+		now := liveFiles(src)
+		for _, f := range files {
+			if strings.HasSuffix(f.Path, "/.") {
+				continue // a symlinked item recorded as a link by older backups
+			}
+			fi, ok := now[f.Path]
+			delete(now, f.Path)
+			switch {
+			case !ok:
+				out = append(out, Change{Path: f.Path, Kind: DriftDeleted})
+			case changed(f, fi, livePath(src, f.Path)):
+				out = append(out, Change{Path: f.Path, Kind: DriftChanged})
+			}
+		}
+		for p := range now {
+			out = append(out, Change{Path: p, Kind: DriftAdded})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+// liveFiles lists the files of src the way the manifest names them, walking
+// links as a backup would.
+func liveFiles(src source) map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+	_ = walkItem(src.path, true, func(_, rel string, fi os.FileInfo) error {
+		if rel == "." {
+			if !fi.IsDir() {
+				files[src.name] = fi
+			}
+			return nil
+		}
+		if !src.keep.keep(rel, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.IsDir() {
+			files[src.name+"/"+filepath.ToSlash(rel)] = fi
+		}
+		return nil
+	})
+	return files
+}
+
+// livePath turns a manifest path back into the file under src.
+func livePath(src source, p string) string {
+	if p == src.name {
+		return src.path
+	}
+	return filepath.Join(src.path, filepath.FromSlash(strings.TrimPrefix(p, src.name+"/")))
+}
+
+// changed reports whether the live file fi at p differs from f. A hard link
+// is compared like any other file.
+func changed(f FileEntry, fi os.FileInfo, p string) bool {
+	symlink := f.LinkKind == LinkSymlink
+	if f.LinkKind == "" && f.Link != "" {
+		// Manifests from before LinkKind: a symlink if it still is one,
+		// otherwise a hard link recorded without size or checksum.
+		if !isLink(fi) {
+			return !sameModTime(fi, f)
+		}
+		symlink = true
+	}
+	if symlink || isLink(fi) {
+		target, err := linkTarget(p, true)
+		return !symlink || err != nil || filepath.ToSlash(target) != f.Link
+	}
+	if fi.Size() != f.Size {
+		return true
+	}
+	if sameModTime(fi, f) {
+		return false
+	}
+	if f.SHA256 == "" {
+		return true
+	}
+	sum, err := fileSHA256(p)
+	return err != nil || sum != f.SHA256
+}
+
+func sameModTime(fi os.FileInfo, f FileEntry) bool {
+	return fi.ModTime().Truncate(time.Second).Equal(f.ModTime.Truncate(time.Second))
+}
+
+func fileSHA256(p string) (string, error) {
+	in, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
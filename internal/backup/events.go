@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// Event kinds reported by Events.
+const (
+	EventAdded     = "added"
+	EventDeleted   = "deleted"
+	EventCopied    = "copied" // to or from replica_path
+	EventCancelled = "cancelled"
+)
+
+// Event is one thing that happened to a backup, read back from lifeboat.log.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"event"`
+	ID     string    `json:"id,omitempty"`
+	Path   string    `json:"path"`
+	Size   string    `json:"size,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Events reconstructs what happened to backups since the given time from
+// lifeboat.log and its rotated copies, oldest first. It only goes back as
+// far as the log does (see log_retention_days and log_max_files).
+func Events(cfg *config.Config, since time.Time) ([]Event, error) {
+	files := logger.Files(cfg.BackupPath)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no log at %s", logger.Path(cfg.BackupPath))
+	}
+	var readers []io.Reader
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	var events []Event
+	actor := ""
+	sc := bufio.NewScanner(io.MultiReader(readers...))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		t, level, msg, ok := logger.ParseLine(sc.Text())
+		if !ok || level != "INFO" {
+			continue
+		}
+		if strings.HasPrefix(msg, "session start ") {
+			actor = ""
+		}
+		if a, ok := strings.CutPrefix(msg, "cleanup confirmed "); ok {
+			actor = a
+		}
+		if a, ok := strings.CutPrefix(msg, "delete confirmed "); ok {
+			actor = a
+		}
+		if t.Before(since) {
+			continue
+		}
+		ev := Event{Time: t}
+		switch {
+		case strings.HasPrefix(msg, "backup done dest="):
+			rest := strings.TrimPrefix(msg, "backup done dest=")
+			i := strings.LastIndex(rest, " size=")
+			if i < 0 {
+				continue
+			}
+			ev.Kind, ev.Path, ev.Size = EventAdded, rest[:i], rest[i+len(" size="):]
+		case strings.HasPrefix(msg, "deleted old backup "):
+			ev.Kind = EventDeleted
+			ev.Path, ev.Size = pathAndSize(strings.TrimPrefix(msg, "deleted old backup "))
+			ev.Detail = actor
+		case strings.HasPrefix(msg, "copy backup done "):
+			ev.Kind = EventCopied
+			ev.Path, ev.Size = pathAndSize(strings.TrimPrefix(msg, "copy backup done "))
+		case strings.HasPrefix(msg, "backup cancelled, removing partial "):
+			ev.Kind, ev.Path = EventCancelled, strings.TrimPrefix(msg, "backup cancelled, removing partial ")
+		default:
+			continue
+		}
+		ev.ID = idFromPath(cfg, ev.Path)
+		events = append(events, ev)
+	}
+	return events, sc.Err()
+}
+
+// pathAndSize splits "<path> (<size>)".
+func pathAndSize(s string) (string, string) {
+	i := strings.LastIndex(s, " (")
+	if i < 0 || !strings.HasSuffix(s, ")") {
+		return s, ""
+	}
+	return s[:i], s[i+2 : len(s)-1]
+}
+
+// idFromPath turns .../YYYYMMDD/HHMM into the backup ID, or "" if p does
+// not end that way.
+func idFromPath(cfg *config.Config, p string) string {
+	when, err := time.ParseInLocation("200601021504",
+		filepath.Base(filepath.Dir(p))+filepath.Base(p), time.Local)
+	if err != nil {
+		return ""
+	}
+	return ID(cfg, HistoryEntry{Path: p, When: when})
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// Health check statuses, worst last. They follow the Nagios plugin
+// convention, so exit codes can be taken from them directly.
+const (
+	HealthOK       = "OK"
+	HealthWarning  = "WARNING"
+	HealthCritical = "CRITICAL"
+)
+
+// HealthCheck is the outcome of one check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// HealthReport is what lifeboat health reports for one instance.
+type HealthReport struct {
+	Status string        `json:"status"` // the worst check
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthLimits are the thresholds Health compares against.
+type HealthLimits struct {
+	MaxAge  time.Duration // newest backup older than this is critical
+	MinFree int64         // less free space on backup_path is critical; 0 = not checked
+}
+
+// Health checks the newest backup's age, the last backup run, free space
+// on backup_path, and that every backup folder is complete (has its
+// manifest and, with replica_path set, its second copy).
+func Health(cfg *config.Config, lim HealthLimits) HealthReport {
+	var r HealthReport
+	add := func(name, status, format string, a ...any) {
+		r.Checks = append(r.Checks, HealthCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	entries, err := History(cfg)
+	switch {
+	case err != nil:
+		add("latest", HealthCritical, "cannot list %s: %v", cfg.BackupPath, err)
+	case len(entries) == 0:
+		add("latest", HealthCritical, "no backups in %s", cfg.BackupPath)
+	default:
+		age := time.Since(entries[0].When)
+		status := HealthOK
+		if lim.MaxAge > 0 && age > lim.MaxAge {
+			status = HealthCritical
+		}
+		add("latest", status, "newest backup %s is %s old", ID(cfg, entries[0]), age.Round(time.Minute))
+	}
+
+	if st, err := ReadState(cfg); err != nil {
+		add("last_run", HealthWarning, "%s unreadable: %v", StateFile, err)
+	} else if st.Failures > 0 {
+		add("last_run", HealthWarning, "%d backup(s) failed in a row, last at %s: %s",
+			st.Failures, st.LastAttempt.Format("2006-01-02 15:04"), st.LastError)
+	} else {
+		add("last_run", HealthOK, "last backup run succeeded")
+	}
+
+	if lim.MinFree > 0 {
+		free, err := diskFree(cfg.BackupPath)
+		switch {
+		case err != nil:
+			add("disk", HealthWarning, "free space of %s unknown: %v", cfg.BackupPath, err)
+		case free < lim.MinFree:
+			add("disk", HealthCritical, "%s free on %s, below %s", humanSize(free), cfg.BackupPath, humanSize(lim.MinFree))
+		default:
+			add("disk", HealthOK, "%s free on %s", humanSize(free), cfg.BackupPath)
+		}
+	}
+
+	var noManifest, notReplicated []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(e.Path, ManifestFile)); err != nil {
+			noManifest = append(noManifest, ID(cfg, e))
+		}
+		if cfg.ReplicaPath != "" && !IsReplicated(cfg, e) {
+			notReplicated = append(notReplicated, ID(cfg, e))
+		}
+	}
+	if len(noManifest) > 0 {
+		add("consistency", HealthWarning, "%d backup(s) without a manifest, incomplete or made before manifests: %s", len(noManifest), firstIDs(noManifest))
+	} else {
+		add("consistency", HealthOK, "every backup has its manifest")
+	}
+	if cfg.ReplicaPath != "" {
+		if len(notReplicated) > 0 {
+			add("replica", HealthWarning, "%d backup(s) missing from %s: %s", len(notReplicated), cfg.ReplicaPath, firstIDs(notReplicated))
+		} else {
+			add("replica", HealthOK, "every backup is in %s", cfg.ReplicaPath)
+		}
+	}
+
+	r.Status = HealthOK
+	for _, c := range r.Checks {
+		if c.Status == HealthCritical || (c.Status == HealthWarning && r.Status == HealthOK) {
+			r.Status = c.Status
+		}
+	}
+	return r
+}
+
+// firstIDs lists up to three IDs and how many more there are.
+func firstIDs(ids []string) string {
+	if len(ids) <= 3 {
+		return strings.Join(ids, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(ids[:3], ", "), len(ids)-3)
+}
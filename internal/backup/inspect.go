@@ -0,0 +1,267 @@
+package backup
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// Find resolves a backup ID to its history entry. An ID is the backup's
+// folder under backup_path written as "20260421/2126", "20260421-2126" or
+// "202604212126", with or without the id_prefix; "latest" picks the newest
+// backup.
+func Find(cfg *config.Config, id string) (HistoryEntry, error) {
+	entries, err := History(cfg)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if len(entries) == 0 {
+		return HistoryEntry{}, errors.New("no backups found")
+	}
+	if id == "latest" {
+		return entries[0], nil
+	}
+	id = strings.TrimPrefix(id, cfg.IDPrefixExpanded())
+	want := strings.NewReplacer("/", "", "\\", "", "-", "").Replace(id)
+	for _, e := range entries {
+		if e.When.Format("200601021504") == want {
+			return e, nil
+		}
+	}
+	return HistoryEntry{}, fmt.Errorf("backup %q not found", id)
+}
+
+// ID returns the identifier shown to users: id_prefix + "YYYYMMDD-HHMM".
+func ID(cfg *config.Config, e HistoryEntry) string {
+	return cfg.IDPrefixExpanded() + e.When.Format("20060102-1504")
+}
+
+// Peek writes the content of one file inside a backup to w. inner is
+// "<item>/<path inside item>", e.g. "MyApp/WEB-INF/web.xml"; for a
+// single-file item such as "app.war" it is just the item name. Archives are
+// streamed, nothing is extracted to disk.
+func Peek(e HistoryEntry, inner string, w io.Writer) error {
+	inner = strings.Trim(filepath.ToSlash(inner), "/")
+	for _, part := range strings.Split(inner, "/") {
+		if part == ".." {
+			return fmt.Errorf("%s: .. is not allowed", inner)
+		}
+	}
+	item, rest, _ := strings.Cut(inner, "/")
+	if item == "" {
+		return errors.New("empty path")
+	}
+
+	archive := filepath.Join(e.Path, item+".tar.zst")
+	if _, err := os.Stat(archive); err != nil {
+		// Plain copy: the file is right there on disk, unless a link in
+		// the backup leads out of it.
+		p, err := filepath.EvalSymlinks(filepath.Join(e.Path, filepath.FromSlash(inner)))
+		if err != nil {
+			return err
+		}
+		root, err := filepath.EvalSymlinks(e.Path)
+		if err != nil {
+			return err
+		}
+		if !inside(root, p) {
+			return fmt.Errorf("%s leads outside the backup", inner)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+
+	want := rest
+	if want == "" {
+		want = item
+	}
+	link, err := peekTar(archive, want, w)
+	if err == nil && link != "" {
+		// A hard link: its content is stored once, under the first name.
+		_, err = peekTar(archive, link, w)
+	}
+	return err
+}
+
+// peekTar writes entry want of archive to w. For a hard link it writes
+// nothing and returns the name the content is stored under.
+func peekTar(archive, want string, w io.Writer) (link string, err error) {
+	tr, closeFn, err := openTarZst(archive)
+	if err != nil {
+		return "", err
+	}
+	defer closeFn()
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("%s not found in %s", want, filepath.Base(archive))
+		}
+		if err != nil {
+			return "", err
+		}
+		if path.Clean(hdr.Name) != want {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			_, err = io.Copy(w, tr)
+			return "", err
+		case tar.TypeLink:
+			return path.Clean(hdr.Linkname), nil
+		}
+	}
+}
+
+// openTarZst opens a .tar.zst archive for sequential reading.
+func openTarZst(archive string) (*tar.Reader, func(), error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(zr), func() { zr.Close(); f.Close() }, nil
+}
+
+// FileEntry is one file inside a backup.
+type FileEntry struct {
+	Path    string    `json:"path"` // "<item>/<path inside item>"
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Link is a symlink's target, or for a hard link the name, relative to
+	// the item, of the file it shares its content with; LinkKind says which.
+	// Manifests from before LinkKind leave it empty.
+	Link     string `json:"link,omitempty"`
+	LinkKind string `json:"link_kind,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// FileEntry.LinkKind values.
+const (
+	LinkSymlink = "symlink"
+	LinkHard    = "hard"
+)
+
+// Contents returns the top-level entries of backup e (archives, copied
+// folders and files) with their size on disk, manifest and hold excluded.
+func Contents(e HistoryEntry) ([]ItemSize, error) {
+	tops, err := os.ReadDir(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	var out []ItemSize
+	for _, t := range tops {
+		if t.Name() == ManifestFile || t.Name() == HoldFile {
+			continue
+		}
+		full := filepath.Join(e.Path, t.Name())
+		size := dirSize(full)
+		if !t.IsDir() {
+			if fi, err := t.Info(); err == nil {
+				size = fi.Size()
+			}
+		}
+		out = append(out, ItemSize{Name: t.Name(), Size: size})
+	}
+	return out, nil
+}
+
+// List returns every file in backup e. Archives are read as listings only;
+// nothing is extracted.
+func List(e HistoryEntry) ([]FileEntry, error) {
+	tops, err := os.ReadDir(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	var files []FileEntry
+	for _, t := range tops {
+		if t.Name() == ManifestFile || t.Name() == HoldFile {
+			continue
+		}
+		full := filepath.Join(e.Path, t.Name())
+		if item, ok := strings.CutSuffix(t.Name(), ".tar.zst"); ok && !t.IsDir() {
+			fs, err := listTarZst(full, item)
+			if err != nil {
+				return files, fmt.Errorf("%s: %w", t.Name(), err)
+			}
+			files = append(files, fs...)
+			continue
+		}
+		err := filepath.Walk(full, func(p string, fi os.FileInfo, werr error) error {
+			if werr != nil {
+				return werr
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(e.Path, p)
+			if err != nil {
+				return err
+			}
+			f := FileEntry{Path: filepath.ToSlash(rel), Size: fi.Size(), ModTime: fi.ModTime()}
+			if isLink(fi) {
+				f.Link, _ = os.Readlink(p)
+				f.LinkKind = LinkSymlink
+				f.Size = 0
+			}
+			files = append(files, f)
+			return nil
+		})
+		if err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+func listTarZst(archive, item string) ([]FileEntry, error) {
+	tr, closeFn, err := openTarZst(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+	var files []FileEntry
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		if hdr.Typeflag == tar.TypeDir || hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		p := item + "/" + name
+		if name == item {
+			p = item // single-file item such as app.war
+		}
+		f := FileEntry{Path: p, Size: hdr.Size, ModTime: hdr.ModTime, Link: hdr.Linkname}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			f.LinkKind = LinkSymlink
+		case tar.TypeLink:
+			f.LinkKind = LinkHard
+		}
+		files = append(files, f)
+	}
+}
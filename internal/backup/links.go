@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isLink reports whether fi (from Lstat) is a symlink or an NTFS junction.
+// Junctions show up as symlinks or, on newer Go versions, as irregular files.
+func isLink(fi os.FileInfo) bool {
+	return fi.Mode()&(os.ModeSymlink|os.ModeIrregular) != 0
+}
+
+// walkItem walks the webapp or folder at root like filepath.Walk, handing
+// fn each path with its name relative to root ("." for root itself). A
+// symlinked root is followed. With follow set, a link in root whose target
+// is inside root, absolute or not (an NTFS junction always is), reaches fn
+// as a link, to be stored as one (see linkTarget); any other link is
+// followed and its content handed over under the link's name, so a backup
+// never depends on files outside it. Without follow, used to copy backups
+// that are already made, every link is kept as is.
+func walkItem(root string, follow bool, fn func(path, rel string, fi os.FileInfo) error) error {
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		return err
+	}
+	if err := fn(real, ".", fi); err != nil || !fi.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	return walkLinked(real, real, ".", follow, []string{real}, fn)
+}
+
+// walkLinked walks dir, which is root or a directory reached through a link
+// from inside it, naming entries prefix/<path inside dir>. open holds the
+// directories being walked, to catch a link that leads back into one.
+func walkLinked(root, dir, prefix string, follow bool, open []string, fn func(path, rel string, fi os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.Join(prefix, rel)
+		if !isLink(fi) || !follow {
+			return fn(path, rel, fi)
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return fn(path, rel, fi) // dangling: nothing to follow
+		}
+		if dir == root && inside(root, target) {
+			return fn(path, rel, fi)
+		}
+		tfi, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		if err := fn(path, rel, tfi); err != nil || !tfi.IsDir() {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+		for _, o := range open {
+			if inside(target, o) {
+				return fmt.Errorf("link %s leads back into %s", path, o)
+			}
+		}
+		return walkLinked(root, target, rel, follow, append(open, target), fn)
+	})
+}
+
+// inside reports whether p is dir or below it; both must be resolved.
+func inside(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// linkTarget returns what the link at path is stored as. With follow set,
+// where walkItem only lets through links that resolve inside the item,
+// that is the target relative to the link's folder, so an absolute link
+// or a junction still points at the same file wherever the backup is
+// restored. Otherwise, and for a dangling link, it is the target as
+// written.
+func linkTarget(path string, follow bool) (string, error) {
+	if follow {
+		target, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			var dir string
+			if dir, err = filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+				return filepath.Rel(dir, target)
+			}
+		}
+	}
+	return os.Readlink(path)
+}
+
+// linkHeader builds a tar symlink entry for path without following it.
+func linkHeader(path, name string, fi os.FileInfo, follow bool) (*tar.Header, error) {
+	target, err := linkTarget(path, follow)
+	if err != nil {
+		return nil, err
+	}
+	return &tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: filepath.ToSlash(target),
+		Mode:     0o777,
+		ModTime:  fi.ModTime(),
+	}, nil
+}
+
+// copyLink recreates the symlink or junction at path as dst and returns
+// its target.
+func copyLink(path, dst string, follow bool) (string, error) {
+	target, err := linkTarget(path, follow)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	return target, os.Symlink(target, dst)
+}
+
+// hardLinks remembers the regular files written during one walk so a later
+// hard link to the same file is stored as a link, not as a second copy.
+type hardLinks struct {
+	bySize map[int64][]*seenFile
+}
+
+// seenFile is a file written under name, relative to the item, with its
+// SHA-256 once known.
+type seenFile struct {
+	info os.FileInfo
+	name string
+	sum  string
+}
+
+// first returns the file behind fi if it was already written, with dup
+// set; otherwise it records fi under name and returns that record, whose
+// sum the caller fills in once the file is written.
+func (h *hardLinks) first(fi os.FileInfo, name string) (s *seenFile, dup bool) {
+	if h.bySize == nil {
+		h.bySize = map[int64][]*seenFile{}
+	}
+	// Only files of equal size can be the same file, which keeps
+	// os.SameFile calls (a file open on Windows) rare.
+	for _, s := range h.bySize[fi.Size()] {
+		if os.SameFile(s.info, fi) {
+			return s, true
+		}
+	}
+	s = &seenFile{info: fi, name: name}
+	h.bySize[fi.Size()] = append(h.bySize[fi.Size()], s)
+	return s, false
+}
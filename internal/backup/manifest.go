@@ -0,0 +1,326 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kannan/tts-lifeboat/internal/app"
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// ManifestFile is the name of the per-backup file listing written next to
+// the backed-up items.
+const ManifestFile = "manifest.json.gz"
+
+// Manifest lists every file in one backup with its size, modification
+// time and SHA-256, for diffing, verifying and picking files later.
+type Manifest struct {
+	Name    string    `json:"name"`
+	Host    string    `json:"host"`
+	Version string    `json:"lifeboat_version"`
+	Created time.Time `json:"created"`
+	// Finished and Consistency tell how far apart the items were captured:
+	// ConsistencyStopped means Tomcat was down for the whole copy, so no
+	// webapp changed in between; ConsistencyLive means it was running.
+	Finished    time.Time `json:"finished"`
+	Consistency string    `json:"consistency"`
+	Note        string    `json:"note,omitempty"`
+	// Tags are labels such as "release" set with lifeboat tag, sorted.
+	Tags []string `json:"tags,omitempty"`
+	// Config is the effective lifeboat.toml that made the backup, as
+	// returned by config.Snapshot.
+	Config string `json:"config,omitempty"`
+	// StreamSHA256 is set for a backup --stdout run: the SHA-256 of the
+	// .tar.zst it wrote, which this manifest describes.
+	StreamSHA256 string      `json:"stream_sha256,omitempty"`
+	Files        []FileEntry `json:"files"`
+}
+
+// Manifest.Consistency values.
+const (
+	ConsistencyStopped = "tomcat-stopped"
+	ConsistencyLive    = "live"
+)
+
+func newManifest(cfg *config.Config, now time.Time) *Manifest {
+	host, _ := os.Hostname()
+	c := ConsistencyLive
+	if cfg.StopTomcat {
+		c = ConsistencyStopped
+	}
+	snap, err := cfg.Snapshot()
+	if err != nil {
+		logger.Error("config snapshot: %v", err)
+	}
+	return &Manifest{Name: cfg.Name, Host: host, Version: app.Version, Created: now, Consistency: c, Config: snap}
+}
+
+// archiveMeta returns the PAX records embedded in every .tar.zst of the
+// backup. Keys use the LIFEBOAT. vendor prefix, e.g. LIFEBOAT.id.
+func (m *Manifest) archiveMeta(id string) map[string]string {
+	meta := map[string]string{
+		"LIFEBOAT.id":      id,
+		"LIFEBOAT.name":    m.Name,
+		"LIFEBOAT.host":    m.Host,
+		"LIFEBOAT.version": m.Version,
+		"LIFEBOAT.created": m.Created.Format(time.RFC3339),
+	}
+	if m.Note != "" {
+		meta["LIFEBOAT.note"] = m.Note
+	}
+	return meta
+}
+
+// maxNote caps the note so a chatty note_command cannot bloat every
+// archive header.
+const maxNote = 500
+
+// clipNote cuts note to at most maxNote bytes without splitting a UTF-8
+// character, which would make the PAX records and manifest invalid.
+func clipNote(note string) string {
+	if len(note) <= maxNote {
+		return note
+	}
+	n := maxNote
+	for n > 0 && !utf8.RuneStart(note[n]) {
+		n--
+	}
+	return note[:n]
+}
+
+type noteKey struct{}
+
+// WithNote attaches a note the user typed to ctx. Run stores it with the
+// backup, ahead of any note_command output.
+func WithNote(ctx context.Context, note string) context.Context {
+	return context.WithValue(ctx, noteKey{}, strings.TrimSpace(note))
+}
+
+// backupNote combines the typed note from ctx with note_command output.
+func backupNote(ctx context.Context, cfg *config.Config) string {
+	typed, _ := ctx.Value(noteKey{}).(string)
+	note := runNote(ctx, cfg)
+	switch {
+	case typed == "":
+	case note == "":
+		note = typed
+		logger.Info("backup note %q", note)
+	default:
+		note = typed + " | " + note
+	}
+	note = clipNote(note)
+	return note
+}
+
+// runNote runs note_command and returns its trimmed output. A failing
+// command only costs the note, never the backup.
+func runNote(ctx context.Context, cfg *config.Config) string {
+	if len(cfg.NoteCommand) == 0 {
+		return ""
+	}
+	out, err := exec.CommandContext(ctx, cfg.NoteCommand[0], cfg.NoteCommand[1:]...).Output()
+	if err != nil {
+		logger.Error("note_command %s: %v", strings.Join(cfg.NoteCommand, " "), err)
+		return ""
+	}
+	note := strings.TrimSpace(string(out))
+	note = clipNote(note)
+	logger.Info("backup note %q", note)
+	return note
+}
+
+// recorder returns a recordFunc that adds files under item to m.
+func (m *Manifest) recorder(item string) recordFunc {
+	return func(rel string, fi os.FileInfo, sum, link string) {
+		p := item + "/" + rel
+		if rel == item {
+			p = item // single-file item such as app.war
+		}
+		f := FileEntry{Path: p, Size: fi.Size(), ModTime: fi.ModTime(), SHA256: sum, Link: link}
+		switch {
+		case link == "":
+		case isLink(fi):
+			f.LinkKind, f.Size = LinkSymlink, 0
+		default:
+			f.LinkKind = LinkHard
+		}
+		m.Files = append(m.Files, f)
+	}
+}
+
+func writeManifest(dest string, m *Manifest) error {
+	m.Finished = time.Now()
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return saveManifest(dest, m)
+}
+
+// saveManifest writes m into the backup folder dest.
+func saveManifest(dest string, m *Manifest) error {
+	return saveManifestAs(filepath.Join(dest, ManifestFile), m)
+}
+
+// saveManifestAs writes m to path. The file is written aside and renamed,
+// so a failed rewrite never loses the old manifest.
+func saveManifestAs(path string, m *Manifest) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	if err := json.NewEncoder(zw).Encode(m); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// SetNote replaces the note in the manifest of backup e; an empty note
+// removes it. Notes in .tar.zst headers keep the note the backup was made
+// with.
+func SetNote(cfg *config.Config, e HistoryEntry, note string) error {
+	note = clipNote(strings.TrimSpace(note))
+	if err := updateManifest(cfg, e, "note", func(m *Manifest) { m.Note = note }); err != nil {
+		return err
+	}
+	logger.Info("backup note changed %s %q", e.Path, note)
+	return nil
+}
+
+// SetTags replaces the tags in the manifest of backup e; none removes
+// them. Tags are stored trimmed, lower case, sorted and without repeats.
+func SetTags(cfg *config.Config, e HistoryEntry, tags []string) error {
+	tags = normalTags(tags)
+	if err := updateManifest(cfg, e, "tags", func(m *Manifest) { m.Tags = tags }); err != nil {
+		return err
+	}
+	logger.Info("backup tags changed %s %q", e.Path, strings.Join(tags, ","))
+	return nil
+}
+
+// HasTag reports whether m carries tag, ignoring case.
+func (m *Manifest) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t, strings.TrimSpace(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalTags(tags []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// updateManifest rewrites the manifest of backup e after change. The copy
+// in replica_path gets the same manifest so both stay the same size.
+func updateManifest(cfg *config.Config, e HistoryEntry, what string, change func(*Manifest)) error {
+	m, err := ReadManifest(e)
+	if err != nil {
+		return fmt.Errorf("backup %s has no manifest to store the %s in: %w", e.Path, what, err)
+	}
+	replicated := IsReplicated(cfg, e)
+	change(m)
+	if err := saveManifest(e.Path, m); err != nil {
+		return err
+	}
+	if replicated {
+		if err := saveManifest(ReplicaPath(cfg, e), m); err != nil {
+			logger.Error("%s not updated in replica %s, it will be copied again: %v", what, ReplicaPath(cfg, e), err)
+		}
+	}
+	return nil
+}
+
+// ReadManifest loads the manifest of backup e. Backups made before
+// manifests existed return an error wrapping os.ErrNotExist.
+func ReadManifest(e HistoryEntry) (*Manifest, error) {
+	f, err := os.Open(filepath.Join(e.Path, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var m Manifest
+	if err := json.NewDecoder(zr).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Verify re-reads backup e and checks it against its manifest: every file
+// listed there must be present with the recorded size, and nothing else.
+// Archives are read to the end, which also catches truncated writes.
+// Returns the number of files checked.
+func Verify(e HistoryEntry) (int, error) {
+	m, err := ReadManifest(e)
+	if err != nil {
+		return 0, fmt.Errorf("no manifest to verify against: %w", err)
+	}
+	files, err := List(e)
+	if err != nil {
+		logger.Error("verify %s: %v", e.Path, err)
+		return len(files), err
+	}
+	want := make(map[string]FileEntry, len(m.Files))
+	for _, f := range m.Files {
+		want[f.Path] = f
+	}
+	var problems []string
+	for _, f := range files {
+		w, ok := want[f.Path]
+		if !ok {
+			problems = append(problems, f.Path+": not in the manifest")
+			continue
+		}
+		delete(want, f.Path)
+		if w.Link == "" && f.Link == "" && w.Size != f.Size {
+			problems = append(problems, fmt.Sprintf("%s: %d bytes, manifest says %d", f.Path, f.Size, w.Size))
+		}
+	}
+	for p := range want {
+		problems = append(problems, p+": missing")
+	}
+	if len(problems) == 0 {
+		logger.Info("backup verified %s files=%d", e.Path, len(files))
+		return len(files), nil
+	}
+	sort.Strings(problems)
+	for _, p := range problems {
+		logger.Error("verify %s: %s", e.Path, p)
+	}
+	if len(problems) > 3 {
+		problems = append(problems[:3], fmt.Sprintf("and %d more", len(problems)-3))
+	}
+	return len(files), fmt.Errorf("backup %s does not match its manifest: %s", e.Path, strings.Join(problems, "; "))
+}
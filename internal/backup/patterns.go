@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// matchPattern reports whether rel, a slash-separated path relative to the
+// item root, matches pattern. The rules follow .gitignore: a trailing "/"
+// matches folders only, a pattern without any other "/" matches at any
+// depth, and "**" spans any number of folders.
+func matchPattern(pattern, rel string, dir bool) bool {
+	p := strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(p, "/") {
+		if !dir {
+			return false
+		}
+		p = strings.TrimSuffix(p, "/")
+	}
+	if !strings.Contains(p, "/") && !strings.HasPrefix(pattern, "/") {
+		p = "**/" + p
+	}
+	return matchParts(strings.Split(p, "/"), strings.Split(rel, "/"))
+}
+
+func matchParts(pat, parts []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(pat[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], parts[0]); !ok {
+			return false
+		}
+		pat, parts = pat[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+func matchAny(patterns []string, rel string, dir bool) bool {
+	for _, p := range patterns {
+		if matchPattern(p, rel, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// webappKeep returns the filter for the webapp called name: exclude and
+// webapp_excludes plus the include/exclude patterns of its [[webapps]]
+// entry, if any.
+func webappKeep(cfg *config.Config, name string) keepFunc {
+	exclude := append(append([]string{}, cfg.Exclude...), cfg.WebappExcludes...)
+	var include []string
+	for _, w := range cfg.Webapps {
+		if w.Name == name {
+			exclude = append(exclude, w.Exclude...)
+			include = w.Include
+		}
+	}
+	if len(exclude) == 0 && len(include) == 0 {
+		return nil
+	}
+	return func(rel string, fi os.FileInfo) bool {
+		if matchAny(exclude, rel, fi.IsDir()) {
+			return false
+		}
+		return fi.IsDir() || len(include) == 0 || matchAny(include, rel, false)
+	}
+}
+
+// withExcludes adds the global exclude patterns to keep.
+func withExcludes(cfg *config.Config, keep keepFunc) keepFunc {
+	if len(cfg.Exclude) == 0 {
+		return keep
+	}
+	return func(rel string, fi os.FileInfo) bool {
+		return !matchAny(cfg.Exclude, rel, fi.IsDir()) && keep.keep(rel, fi)
+	}
+}
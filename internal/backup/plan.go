@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// PlannedItem is one entry a backup would write into its folder.
+type PlannedItem struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Output  string `json:"output"` // "MyApp.tar.zst", "MyApp/", "app.war", "db-appdb.sql"
+	Files   int    `json:"files"`
+	Bytes   int64  `json:"bytes"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+// PlannedItem.Kind values. A dump's files and bytes are unknown until it
+// runs.
+const (
+	PlanWebapp = "webapp"
+	PlanFolder = "folder" // extra_folders and the Tomcat configuration
+	PlanDump   = "dump"
+)
+
+// Plan is what a backup of some items would copy right now.
+type Plan struct {
+	Items []PlannedItem `json:"items"`
+	Files int           `json:"files"`
+	Bytes int64         `json:"bytes"`
+	// Ratio is the size on disk / original size of past backups (see
+	// Stats); 0 when there is no history to go by.
+	Ratio float64 `json:"ratio"`
+	// Projected estimates the new backup's size on disk from Ratio; 0 when
+	// it cannot be estimated. Database dumps are not counted.
+	Projected int64 `json:"projected_bytes"`
+}
+
+// PlanBackup walks items plus extra_folders with the same filters Run
+// uses, without copying anything.
+func PlanBackup(cfg *config.Config, items []Item) (Plan, error) {
+	var p Plan
+	var compressed, stored int64
+	add := func(name, kind, path string, keep keepFunc) {
+		pi := PlannedItem{Name: name, Kind: kind}
+		fi, err := os.Stat(path)
+		if err != nil {
+			pi.Missing = true
+			p.Items = append(p.Items, pi)
+			return
+		}
+		compress := cfg.Compression && !storeAsIs(cfg, path)
+		switch {
+		case compress:
+			pi.Output = name + ".tar.zst"
+		case fi.IsDir():
+			pi.Output = name + "/"
+		default:
+			pi.Output = name
+		}
+		pi.Files, pi.Bytes = countTree(path, keep)
+		p.Items = append(p.Items, pi)
+		p.Files += pi.Files
+		p.Bytes += pi.Bytes
+		if compress {
+			compressed += pi.Bytes
+		} else {
+			stored += pi.Bytes
+		}
+	}
+	for _, it := range items {
+		add(it.Name, PlanWebapp, it.Path, webappKeep(cfg, it.Name))
+	}
+	for _, x := range extraSources(cfg) {
+		add(x.name, PlanFolder, x.path, x.keep)
+	}
+	for _, db := range cfg.Databases {
+		out := "db-" + db.Name + ".sql"
+		if cfg.Compression {
+			out += ".tar.zst"
+		}
+		p.Items = append(p.Items, PlannedItem{Name: "db-" + db.Name, Kind: PlanDump, Output: out})
+	}
+
+	st, err := CollectStats(cfg)
+	if err != nil {
+		return p, err
+	}
+	p.Ratio = st.Ratio
+	switch {
+	case compressed == 0:
+		p.Projected = stored
+	case p.Ratio > 0:
+		p.Projected = stored + int64(float64(compressed)*p.Ratio)
+	}
+	return p, nil
+}
+
+// countTree returns the files under path that keep lets through and their
+// total size. A single file counts as itself.
+func countTree(path string, keep keepFunc) (files int, bytes int64) {
+	_ = walkItem(path, true, func(_, rel string, fi os.FileInfo) error {
+		if rel != "." && !keep.keep(rel, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		files++
+		if fi.Mode().IsRegular() {
+			bytes += fi.Size()
+		}
+		return nil
+	})
+	return files, bytes
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package backup
+
+import "syscall"
+
+// processAlive reports whether a process with this PID is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
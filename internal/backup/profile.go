@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// keepFunc decides which files of an item are copied. rel is relative to
+// the item root. Returning false for a directory skips all of it. nil
+// keeps everything.
+type keepFunc func(rel string, fi os.FileInfo) bool
+
+func (k keepFunc) keep(rel string, fi os.FileInfo) bool {
+	return k == nil || k(filepath.ToSlash(rel), fi)
+}
+
+// source is a folder copied after the selected webapps: an extra_folders
+// entry or part of the Tomcat conf profile.
+type source struct {
+	name string
+	path string
+	keep keepFunc
+}
+
+// extraSources lists what every backup adds to the selected webapps.
+func extraSources(cfg *config.Config) []source {
+	var out []source
+	for _, folder := range cfg.ExtraFolders {
+		out = append(out, source{name: filepath.Base(folder), path: folder})
+	}
+	if cfg.IncludeTomcatConf {
+		out = append(out, tomcatProfile(filepath.Dir(cfg.WebappsPath))...)
+	}
+	for i := range out {
+		out[i].keep = withExcludes(cfg, out[i].keep)
+	}
+	return out
+}
+
+// stockJars are the jars every Tomcat 8.5-11 ships in lib/. Anything else
+// there was added by hand and is worth keeping.
+var stockJars = []string{
+	"annotations-api.jar", "catalina*.jar", "ecj-*.jar", "el-api.jar",
+	"jasper*.jar", "jaspic-api.jar", "jsp-api.jar", "servlet-api.jar",
+	"tomcat-*.jar", "websocket-*.jar", "jakartaee-migration-*.jar",
+}
+
+// tomcatProfile returns the Tomcat configuration under base (the parent of
+// webapps_path, i.e. CATALINA_BASE): all of conf/, the custom jars in lib/
+// and bin/setenv.*. Parts that do not exist are left out.
+func tomcatProfile(base string) []source {
+	customJar := func(rel string, fi os.FileInfo) bool {
+		if fi.IsDir() {
+			return true
+		}
+		name := strings.ToLower(path.Base(rel))
+		for _, p := range stockJars {
+			if ok, _ := path.Match(p, name); ok {
+				return false
+			}
+		}
+		return true
+	}
+	setenv := func(rel string, fi os.FileInfo) bool {
+		return !fi.IsDir() && strings.HasPrefix(strings.ToLower(rel), "setenv.")
+	}
+
+	var out []source
+	if fi, err := os.Stat(filepath.Join(base, "conf")); err == nil && fi.IsDir() {
+		out = append(out, source{name: "tomcat-conf", path: filepath.Join(base, "conf")})
+	}
+	for _, s := range []source{
+		{name: "tomcat-lib", path: filepath.Join(base, "lib"), keep: customJar},
+		{name: "tomcat-bin", path: filepath.Join(base, "bin"), keep: setenv},
+	} {
+		if anyKept(s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// anyKept reports whether s would copy at least one file.
+func anyKept(s source) bool {
+	found := false
+	_ = walkItem(s.path, true, func(_, rel string, fi os.FileInfo) error {
+		if found {
+			return filepath.SkipAll
+		}
+		if rel == "." {
+			return nil
+		}
+		if !s.keep.keep(rel, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.IsDir() {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
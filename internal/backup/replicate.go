@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// ReplicaPath is where backup e lives under replica_path, using the same
+// YYYYMMDD/HHMM layout as backup_path.
+func ReplicaPath(cfg *config.Config, e HistoryEntry) string {
+	return filepath.Join(cfg.ReplicaPath, e.When.Format("20060102"), e.When.Format("1504"))
+}
+
+// IsReplicated reports whether a complete copy of e exists in replica_path.
+func IsReplicated(cfg *config.Config, e HistoryEntry) bool {
+	if cfg.ReplicaPath == "" {
+		return false
+	}
+	info, err := os.Stat(ReplicaPath(cfg, e))
+	return err == nil && info.IsDir() && dirSize(ReplicaPath(cfg, e)) == e.Size
+}
+
+// Replicate copies backup e to replica_path. An existing replica is
+// replaced.
+func Replicate(ctx context.Context, cfg *config.Config, e HistoryEntry) (int64, error) {
+	if cfg.ReplicaPath == "" {
+		return 0, errors.New("replica_path is not set")
+	}
+	return copyBackup(ctx, e.Path, ReplicaPath(cfg, e))
+}
+
+// copyBackup copies one backup folder to final. The copy is written to a
+// ".partial" folder first and renamed when complete, so an interrupted
+// copy is never mistaken for a good one.
+func copyBackup(ctx context.Context, src, final string) (int64, error) {
+	partial := final + ".partial"
+	_ = os.RemoveAll(partial)
+	logger.Info("copy backup start %s -> %s", src, final)
+	n, err := copyDir(ctx, src, partial, nil, nil, false)
+	if err != nil {
+		_ = os.RemoveAll(partial)
+		logger.Error("copy backup %s: %v", src, err)
+		return n, err
+	}
+	if err := os.RemoveAll(final); err != nil {
+		return n, err
+	}
+	if err := os.Rename(partial, final); err != nil {
+		logger.Error("copy backup %s: %v", src, err)
+		return n, err
+	}
+	logger.Info("copy backup done %s (%s)", final, humanSize(n))
+	return n, nil
+}
+
+// Pending returns the backups that have no complete copy in replica_path
+// yet, newest first. This is the replication queue: it is derived from the
+// two folder trees, so nothing needs to be recorded when a copy fails.
+func Pending(cfg *config.Config) ([]HistoryEntry, error) {
+	entries, err := History(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var pending []HistoryEntry
+	for _, e := range entries {
+		if !IsReplicated(cfg, e) {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+// ReplicaReachable reports whether replica_path can be written to now,
+// creating it if needed.
+func ReplicaReachable(cfg *config.Config) error {
+	if cfg.ReplicaPath == "" {
+		return errors.New("replica_path is not set")
+	}
+	return os.MkdirAll(cfg.ReplicaPath, 0o755)
+}
+
+// Flush replicates every pending backup, oldest first so a long queue
+// drains in order. It stops at the first failure and returns how many
+// backups were copied.
+func Flush(ctx context.Context, cfg *config.Config, progress func(e HistoryEntry)) (int, error) {
+	if err := ReplicaReachable(cfg); err != nil {
+		logger.Info("replica_path %s not reachable, %v; copies stay queued", cfg.ReplicaPath, err)
+		return 0, err
+	}
+	pending, err := Pending(cfg)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for i := len(pending) - 1; i >= 0; i-- {
+		if progress != nil {
+			progress(pending[i])
+		}
+		if _, err := Replicate(ctx, cfg, pending[i]); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// ReplicaOnly returns backups that exist in replica_path but not in
+// backup_path, e.g. after the local disk was lost or cleaned by hand.
+func ReplicaOnly(cfg *config.Config) ([]HistoryEntry, error) {
+	if cfg.ReplicaPath == "" {
+		return nil, errors.New("replica_path is not set")
+	}
+	remote, err := historyIn(cfg.ReplicaPath)
+	if err != nil {
+		return nil, err
+	}
+	local, err := History(cfg)
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, e := range local {
+		have[ID(cfg, e)] = true
+	}
+	var only []HistoryEntry
+	for _, e := range remote {
+		if !have[ID(cfg, e)] {
+			only = append(only, e)
+		}
+	}
+	return only, nil
+}
+
+// Pull copies a replica-only backup back into backup_path.
+func Pull(ctx context.Context, cfg *config.Config, e HistoryEntry) (int64, error) {
+	final := filepath.Join(cfg.BackupPath, e.When.Format("20060102"), e.When.Format("1504"))
+	return copyBackup(ctx, e.Path, final)
+}
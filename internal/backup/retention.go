@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// Keep labels for the history view.
+const (
+	KeepMonthly = "monthly"
+	KeepWeekly  = "weekly"
+	KeepDaily   = "daily"
+	KeepRecent  = "recent"
+	KeepExpired = "expired"
+	KeepForever = "forever"
+	KeepHeld    = "held" // kept past the rules by `lifeboat extend`
+)
+
+// HoldFile, inside a backup folder, holds the date until which cleanup
+// must keep that backup whatever the retention rules say.
+const HoldFile = "KEEP-UNTIL.txt"
+
+// readHold returns the KEEP-UNTIL date of the backup folder dir, or the
+// zero time when it has none.
+func readHold(dir string) time.Time {
+	data, err := os.ReadFile(filepath.Join(dir, HoldFile))
+	if err != nil {
+		return time.Time{}
+	}
+	t, _ := time.ParseInLocation("2006-01-02", strings.TrimSpace(string(data)), time.Local)
+	return t
+}
+
+// Expires returns when the retention rules (retention_days and any
+// extension) let cleanup delete e, or the zero time when that is not a
+// fixed date (retention off, or grandfather-father-son rotation without
+// an extension).
+func Expires(cfg *config.Config, e HistoryEntry) time.Time {
+	switch {
+	case cfg.GFS():
+		return e.KeepUntil
+	case cfg.RetentionDays <= 0:
+		return time.Time{}
+	}
+	t := e.When.AddDate(0, 0, cfg.RetentionDays)
+	if e.KeepUntil.After(t) {
+		return e.KeepUntil
+	}
+	return t
+}
+
+// held reports whether e's KEEP-UNTIL date, which counts as a whole day,
+// is still ahead.
+func held(e HistoryEntry, now time.Time) bool {
+	return !e.KeepUntil.IsZero() && now.Before(e.KeepUntil.AddDate(0, 0, 1))
+}
+
+// Extend keeps backup e for days more than it would otherwise be kept and
+// returns the new date. The date goes into HoldFile, in the replica copy
+// too when there is one, so both stay the same size.
+func Extend(cfg *config.Config, e HistoryEntry, days int) (time.Time, error) {
+	if days <= 0 {
+		return time.Time{}, fmt.Errorf("days must be 1 or more")
+	}
+	base := Expires(cfg, e)
+	if base.IsZero() && !cfg.GFS() {
+		return time.Time{}, fmt.Errorf("retention_days = 0: backups are kept forever already")
+	}
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	if base.Before(today) {
+		base = today
+	}
+	until := base.AddDate(0, 0, days)
+	replicated := IsReplicated(cfg, e)
+	line := []byte(until.Format("2006-01-02") + "\n")
+	if err := os.WriteFile(filepath.Join(e.Path, HoldFile), line, 0o644); err != nil {
+		return time.Time{}, err
+	}
+	logger.Info("backup kept until %s %s", until.Format("2006-01-02"), e.Path)
+	if replicated {
+		if err := os.WriteFile(filepath.Join(ReplicaPath(cfg, e), HoldFile), line, 0o644); err != nil {
+			logger.Error("hold not written to replica %s, it will be copied again: %v", ReplicaPath(cfg, e), err)
+		}
+	}
+	return until, nil
+}
+
+// Classify returns the retention label of every entry, keyed by path.
+// entries must be newest first, as History returns them.
+//
+// With keep_daily/keep_weekly/keep_monthly set (grandfather-father-son),
+// the newest backup of each of the last N days, weeks and months is kept
+// and labelled with its longest-lived class; everything else is expired.
+// Otherwise backups older than retention_days are expired.
+func Classify(cfg *config.Config, entries []HistoryEntry) map[string]string {
+	labels := make(map[string]string, len(entries))
+	defer func() {
+		now := time.Now()
+		for _, e := range entries {
+			if labels[e.Path] == KeepExpired && held(e, now) {
+				labels[e.Path] = KeepHeld
+			}
+		}
+	}()
+	if !cfg.GFS() {
+		cutoff := time.Now().AddDate(0, 0, -cfg.RetentionDays)
+		for _, e := range entries {
+			switch {
+			case cfg.RetentionDays <= 0:
+				labels[e.Path] = KeepForever
+			case e.When.Before(cutoff):
+				labels[e.Path] = KeepExpired
+			default:
+				labels[e.Path] = KeepRecent
+			}
+		}
+		return labels
+	}
+
+	for _, e := range entries {
+		labels[e.Path] = KeepExpired
+	}
+	// Later passes overwrite earlier ones, so the longest-lived class wins.
+	keepNewestPer(entries, cfg.KeepDaily, KeepDaily, labels, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepNewestPer(entries, cfg.KeepWeekly, KeepWeekly, labels, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	})
+	keepNewestPer(entries, cfg.KeepMonthly, KeepMonthly, labels, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+	return labels
+}
+
+// keepNewestPer labels the newest entry of each of the n most recent
+// periods (as named by period) with label.
+func keepNewestPer(entries []HistoryEntry, n int, label string, labels map[string]string, period func(time.Time) string) {
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if len(seen) >= n {
+			return
+		}
+		p := period(e.When)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		labels[e.Path] = label
+	}
+}
@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// RunLockFile in backup_path marks a command that writes to or deletes
+// from it (backup, import, cleanup, delete, ...) in progress, so a
+// cron-triggered run does not start on top of another.
+const RunLockFile = ".lifeboat.lock"
+
+// runLocks counts the holders of each lock within this process, so a
+// backup can run its replica copy and auto_cleanup under its own lock.
+var runLocks struct {
+	sync.Mutex
+	held map[string]int
+}
+
+// RunLock is what RunLockFile holds: who took it.
+type RunLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+// LockedError is returned by AcquireRunLock while another lifeboat holds
+// backup_path.
+type LockedError struct {
+	Path   string
+	Holder RunLock
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder.PID == 0 {
+		return fmt.Sprintf("%s is being written by another lifeboat; if none is running, use --force-unlock", e.Path)
+	}
+	return fmt.Sprintf("backup_path is in use by lifeboat %s (pid %d on %s) since %s; if it is no longer running, use --force-unlock",
+		e.Holder.Command, e.Holder.PID, e.Holder.Host, e.Holder.Started.Format("2006-01-02 15:04"))
+}
+
+func runLockPath(cfg *config.Config) string {
+	return filepath.Join(cfg.BackupPath, RunLockFile)
+}
+
+// AcquireRunLock takes RunLockFile for command ("backup", "cleanup", ...)
+// and returns the function that releases it. Taking it again in the same
+// process nests. A lock left by a process on this host that is no longer
+// running is stale and taken over; one from another host cannot be
+// checked and only goes with --force-unlock.
+func AcquireRunLock(cfg *config.Config, command string) (func(), error) {
+	path := runLockPath(cfg)
+	runLocks.Lock()
+	defer runLocks.Unlock()
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			runLocks.Lock()
+			defer runLocks.Unlock()
+			if runLocks.held[path]--; runLocks.held[path] == 0 {
+				delete(runLocks.held, path)
+				_ = os.Remove(path)
+			}
+		})
+	}
+	if runLocks.held[path] > 0 {
+		runLocks.held[path]++
+		return release, nil
+	}
+	if err := takeRunLock(path, cfg.BackupPath, command); err != nil {
+		return nil, err
+	}
+	if runLocks.held == nil {
+		runLocks.held = map[string]int{}
+	}
+	runLocks.held[path] = 1
+	return release, nil
+}
+
+// takeRunLock creates the lock file at path, taking over a stale one.
+func takeRunLock(path, dir, command string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	me := RunLock{PID: os.Getpid(), Host: host, Command: command, Started: time.Now()}
+	data, err := json.MarshalIndent(me, "", "  ")
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+			}
+			return err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		var held RunLock
+		if err == nil {
+			err = json.Unmarshal(raw, &held)
+		}
+		if err != nil {
+			// Unreadable: either half written just now, or left torn by a
+			// crash. Only the latter is old.
+			if fi, serr := os.Stat(path); serr != nil || time.Since(fi.ModTime()) < time.Minute {
+				return &LockedError{Path: path}
+			}
+		} else if held.Host != host || (held.PID != me.PID && processAlive(held.PID)) {
+			return &LockedError{Path: path, Holder: held}
+		}
+		if err := removeStaleLock(path, raw, me.PID); err != nil {
+			return err
+		}
+		logger.Info("removed stale %s left by pid %d (%s since %s)", path, held.PID, held.Command, held.Started.Format("2006-01-02 15:04"))
+	}
+	return fmt.Errorf("could not take %s", path)
+}
+
+// removeStaleLock removes the lock at path if it still holds stale. Two
+// runs that found the same stale lock must not both take over: removing
+// it outright could remove the lock the first one has just written in its
+// place. So it is moved aside, which only one run can do with any given
+// file, and put back if it turns out to be a new one.
+func removeStaleLock(path string, stale []byte, pid int) error {
+	aside := fmt.Sprintf("%s.stale-%d", path, pid)
+	if err := os.Rename(path, aside); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	moved, err := os.ReadFile(aside)
+	if err == nil && bytes.Equal(moved, stale) {
+		return os.Remove(aside)
+	}
+	// Put it back unless yet another run has taken the lock meanwhile.
+	if err := os.Link(aside, path); err != nil && !errors.Is(err, os.ErrExist) {
+		_ = os.Rename(aside, path)
+	}
+	_ = os.Remove(aside)
+	var held RunLock
+	_ = json.Unmarshal(moved, &held)
+	return &LockedError{Path: path, Holder: held}
+}
+
+// ForceUnlock removes RunLockFile whoever holds it and returns what it
+// held; ok is false when there was no lock.
+func ForceUnlock(cfg *config.Config) (held RunLock, ok bool, err error) {
+	path := runLockPath(cfg)
+	held, _ = readRunLock(path)
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return held, false, nil
+		}
+		return held, false, err
+	}
+	logger.Info("force-unlocked %s held by pid %d on %s (%s since %s)", path, held.PID, held.Host, held.Command, held.Started.Format("2006-01-02 15:04"))
+	return held, true, nil
+}
+
+func readRunLock(path string) (RunLock, error) {
+	var l RunLock
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, err
+	}
+	return l, json.Unmarshal(data, &l)
+}
@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// StateFile keeps the outcome of the latest backups under backup_path/logs,
+// so a failed scheduled backup stays visible without reading the log.
+const StateFile = "last-backup.json"
+
+// RunState is what StateFile holds.
+type RunState struct {
+	LastAttempt time.Time  `json:"last_attempt"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastPath    string     `json:"last_path,omitempty"`
+	// LastStream is the ID of the latest backup --stdout run when that was
+	// the last success; it made no folder to put in LastPath.
+	LastStream string `json:"last_stream,omitempty"`
+	// Failures counts the backups that failed since the last success.
+	Failures  int    `json:"consecutive_failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func statePath(cfg *config.Config) string {
+	return filepath.Join(cfg.BackupPath, "logs", StateFile)
+}
+
+// ReadState loads StateFile; before the first backup it is empty.
+func ReadState(cfg *config.Config) (RunState, error) {
+	var st RunState
+	data, err := os.ReadFile(statePath(cfg))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, json.Unmarshal(data, &st)
+}
+
+// RecordResult updates StateFile with the outcome of one backup: dest on
+// success, runErr on failure. Problems writing it are only logged.
+func RecordResult(cfg *config.Config, dest string, runErr error) {
+	recordRun(cfg, runErr, func(st *RunState) { st.LastPath, st.LastStream = dest, "" })
+}
+
+// RecordStreamResult is RecordResult for a backup --stdout run with the
+// given stream ID.
+func RecordStreamResult(cfg *config.Config, id string, runErr error) {
+	recordRun(cfg, runErr, func(st *RunState) { st.LastPath, st.LastStream = "", id })
+}
+
+// recordRun writes runErr to StateFile, or on success the time and what
+// success sets.
+func recordRun(cfg *config.Config, runErr error, success func(*RunState)) {
+	st, err := ReadState(cfg)
+	if err != nil {
+		logger.Info("%s unreadable, starting it afresh: %v", StateFile, err)
+		st = RunState{}
+	}
+	st.LastAttempt = time.Now()
+	if runErr == nil {
+		now := st.LastAttempt
+		st.LastSuccess = &now
+		success(&st)
+		st.Failures, st.LastError = 0, ""
+	} else {
+		st.Failures++
+		st.LastError = runErr.Error()
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(statePath(cfg)), 0o755)
+	}
+	if err == nil {
+		tmp := statePath(cfg) + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, statePath(cfg))
+		}
+	}
+	if err != nil {
+		logger.Error("record backup result in %s: %v", StateFile, err)
+	}
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// snapshot maps paths onto Volume Shadow Copies of their volumes, so files
+// Tomcat keeps open (HSQLDB, Lucene indexes) are read as they were at one
+// moment instead of failing or changing halfway through the copy.
+type snapshot struct {
+	devices map[string]string // "C:" -> \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopyN, "" = read live
+	ids     []string
+}
+
+// readFromSnapshot points items and extras at shadow copies when use_vss
+// is set. Volumes that cannot be snapshotted (not Windows, not elevated,
+// a network share, VSS stopped) are read live and the reason is logged as
+// an error, so the run ends with warnings. release deletes the snapshots.
+func readFromSnapshot(ctx context.Context, cfg *config.Config, items []Item, extras []source) ([]Item, []source, func()) {
+	if !cfg.UseVSS {
+		return items, extras, func() {}
+	}
+	s := &snapshot{devices: map[string]string{}}
+	paths := make([]string, 0, len(items)+len(extras))
+	for _, it := range items {
+		paths = append(paths, it.Path)
+	}
+	for _, x := range extras {
+		paths = append(paths, x.path)
+	}
+	s.take(ctx, paths)
+
+	mappedItems := make([]Item, len(items))
+	for i, it := range items {
+		it.Path = s.path(it.Path)
+		mappedItems[i] = it
+	}
+	mappedExtras := make([]source, len(extras))
+	for i, x := range extras {
+		x.path = s.path(x.path)
+		mappedExtras[i] = x
+	}
+	return mappedItems, mappedExtras, s.release
+}
+
+// take snapshots the volume of each path once.
+func (s *snapshot) take(ctx context.Context, paths []string) {
+	if runtime.GOOS != "windows" {
+		logger.Error("use_vss: Volume Shadow Copy exists only on Windows, reading live files")
+		return
+	}
+	for _, p := range paths {
+		vol := strings.ToUpper(filepath.VolumeName(p))
+		if _, seen := s.devices[vol]; seen {
+			continue
+		}
+		s.devices[vol] = ""
+		if len(vol) != 2 || vol[1] != ':' {
+			logger.Error("use_vss: %s is not on a local drive, reading live files", p)
+			continue
+		}
+		id, device, err := createShadow(ctx, vol)
+		if err != nil {
+			logger.Error("use_vss: no snapshot of %s, reading live files: %v", vol, err)
+			continue
+		}
+		logger.Info("vss snapshot %s of %s at %s", id, vol, device)
+		s.devices[vol] = device
+		s.ids = append(s.ids, id)
+	}
+}
+
+// path returns where p is read from: inside the snapshot of its volume if
+// there is one, else p itself.
+func (s *snapshot) path(p string) string {
+	vol := filepath.VolumeName(p)
+	if device := s.devices[strings.ToUpper(vol)]; device != "" {
+		return device + p[len(vol):]
+	}
+	return p
+}
+
+// release deletes the snapshots. A snapshot left behind only costs disk
+// space on the volume, so failures are logged with the manual fix.
+func (s *snapshot) release() {
+	for _, id := range s.ids {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		_, err := powershell(ctx, fmt.Sprintf(`Get-WmiObject Win32_ShadowCopy -Filter "ID='%s'" | ForEach-Object { $_.Delete() }`, id))
+		cancel()
+		if err != nil {
+			logger.Error("use_vss: snapshot %s not deleted, run: vssadmin delete shadows /shadow=%s: %v", id, id, err)
+			continue
+		}
+		logger.Info("vss snapshot %s deleted", id)
+	}
+}
+
+// createShadow asks VSS for a snapshot of vol ("C:") and returns its ID and
+// the device path its files are read through. Needs an elevated process.
+func createShadow(ctx context.Context, vol string) (id, device string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	out, err := powershell(ctx, fmt.Sprintf(`$r = ([wmiclass]'Win32_ShadowCopy').Create('%s\', 'ClientAccessible')
+if ($r.ReturnValue -ne 0) { Write-Output "Win32_ShadowCopy.Create returned $($r.ReturnValue)"; exit 1 }
+$s = Get-WmiObject Win32_ShadowCopy -Filter "ID='$($r.ShadowID)'"
+Write-Output $r.ShadowID
+Write-Output $s.DeviceObject`, vol))
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Fields(out)
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], `\\?\GLOBALROOT\`) {
+		return "", "", fmt.Errorf("unexpected answer from VSS: %q", out)
+	}
+	return lines[0], lines[1], nil
+}
+
+func powershell(ctx context.Context, script string) (string, error) {
+	out, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", errors.New("powershell: timed out")
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
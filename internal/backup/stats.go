@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+)
+
+// MonthStats summarises the backups made in one calendar month.
+type MonthStats struct {
+	Month       string        `json:"month"` // "2026-04"
+	Backups     int           `json:"backups"`
+	AvgSize     int64         `json:"avg_size"`     // on disk
+	AvgOriginal int64         `json:"avg_original"` // before compression, from manifests
+	AvgDuration time.Duration `json:"avg_duration_ns"`
+}
+
+// ItemSize is one webapp or folder and its size in the newest backup.
+type ItemSize struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Stats aggregates every backup under backup_path for capacity planning.
+type Stats struct {
+	Backups     int           `json:"backups"`
+	TotalSize   int64         `json:"total_size"`
+	AvgDuration time.Duration `json:"avg_duration_ns"`
+	// Ratio is size on disk / original size over backups with a manifest;
+	// 1 for plain copies, lower is better.
+	Ratio   float64      `json:"ratio"`
+	Months  []MonthStats `json:"months"` // oldest first
+	Largest []ItemSize   `json:"largest"`
+}
+
+// CollectStats reads every backup and its manifest. Backups made before
+// manifests existed count towards sizes only.
+func CollectStats(cfg *config.Config) (Stats, error) {
+	entries, err := History(cfg)
+	if err != nil {
+		return Stats{}, err
+	}
+	var st Stats
+	type acc struct {
+		n, withManifest, timed int
+		size, orig             int64
+		dur                    time.Duration
+	}
+	months := map[string]*acc{}
+	var disk, orig int64
+	var dur time.Duration
+	timed := 0
+	for _, e := range entries {
+		st.Backups++
+		st.TotalSize += e.Size
+		key := e.When.Format("2006-01")
+		a := months[key]
+		if a == nil {
+			a = &acc{}
+			months[key] = a
+		}
+		a.n++
+		a.size += e.Size
+
+		m, err := ReadManifest(e)
+		if err != nil {
+			continue
+		}
+		var o int64
+		for _, f := range m.Files {
+			o += f.Size
+		}
+		a.withManifest++
+		a.orig += o
+		disk += e.Size
+		orig += o
+		if !m.Finished.IsZero() {
+			d := m.Finished.Sub(m.Created)
+			a.timed++
+			a.dur += d
+			timed++
+			dur += d
+		}
+		if st.Largest == nil {
+			st.Largest = itemSizes(m) // entries are newest first
+		}
+	}
+	if orig > 0 {
+		st.Ratio = float64(disk) / float64(orig)
+	}
+	if timed > 0 {
+		st.AvgDuration = dur / time.Duration(timed)
+	}
+	for key, a := range months {
+		ms := MonthStats{Month: key, Backups: a.n, AvgSize: a.size / int64(a.n)}
+		if a.withManifest > 0 {
+			ms.AvgOriginal = a.orig / int64(a.withManifest)
+		}
+		if a.timed > 0 {
+			ms.AvgDuration = a.dur / time.Duration(a.timed)
+		}
+		st.Months = append(st.Months, ms)
+	}
+	sort.Slice(st.Months, func(i, j int) bool { return st.Months[i].Month < st.Months[j].Month })
+	return st, nil
+}
+
+// itemSizes totals a manifest per top-level item, largest first.
+func itemSizes(m *Manifest) []ItemSize {
+	sizes := map[string]int64{}
+	for _, f := range m.Files {
+		item, _, _ := strings.Cut(f.Path, "/")
+		sizes[item] += f.Size
+	}
+	out := make([]ItemSize, 0, len(sizes))
+	for name, size := range sizes {
+		out = append(out, ItemSize{Name: name, Size: size})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Size != out[j].Size {
+			return out[i].Size > out[j].Size
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// StreamResult is what a Stream run produced.
+type StreamResult struct {
+	Bytes    int64  // bytes read from the sources
+	ID       string // like a backup ID, naming the stream in the log
+	SHA256   string // of the stream written
+	Manifest string // local file listing the stream's contents
+}
+
+// Stream writes items plus extra_folders and the [[databases]] dumps to w
+// as one .tar.zst, each under its own top-level name, for pipelines such as
+// ssh, gpg or a tape writer. No backup folder is made; the stream's
+// manifest, with its SHA-256, is kept as
+// backup_path/logs/stream-YYYYMMDD-HHMM.manifest.json.gz. The time limits
+// and wait_for_backup_path_minutes apply as they do to Run.
+func Stream(ctx context.Context, cfg *config.Config, items []Item, w io.Writer, progress func(step, total int, name string)) (res StreamResult, err error) {
+	if cfg.MaxDurationMinutes > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.MaxDurationMinutes)*time.Minute)
+		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("backup exceeded max_duration_minutes (%d): %w", cfg.MaxDurationMinutes, err)
+				logger.Error("%v", err)
+			}
+		}()
+	}
+	if err := waitForBackupPath(ctx, cfg); err != nil {
+		return res, err
+	}
+	now := time.Now()
+	id := cfg.IDPrefixExpanded() + now.Format("20060102-1504")
+	res.ID = id
+	logger.Info("stream backup start id=%s items=%d", id, len(items))
+
+	items, extras, release := readFromSnapshot(ctx, cfg, items, extraSources(cfg))
+	defer release()
+	sources := make([]source, 0, len(items)+len(extras))
+	for _, it := range items {
+		sources = append(sources, source{name: it.Name, path: it.Path, keep: webappKeep(cfg, it.Name)})
+	}
+	sources = append(sources, extras...)
+	total := len(sources) + len(cfg.Databases)
+
+	h := sha256.New()
+	tw, err := newTarZst(chaosWriter(io.MultiWriter(w, h)), cfg.StoreExtensions)
+	if err != nil {
+		return res, err
+	}
+	defer tw.Close()
+	m := newManifest(cfg, now)
+	m.Note = backupNote(ctx, cfg)
+	meta := m.archiveMeta(id)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: meta}); err != nil {
+		return res, err
+	}
+
+	for i, s := range sources {
+		if progress != nil {
+			progress(i+1, total, s.name)
+		}
+		if _, err := os.Stat(s.path); err != nil {
+			logger.Error("%s missing, skipping", s.path)
+			continue
+		}
+		n, err := withItemLimit(ctx, cfg, func(ctx context.Context) (int64, error) {
+			return writeTree(ctx, tw, s.path, s.name, m.recorder(s.name), s.keep, true)
+		})
+		res.Bytes += n
+		if err != nil {
+			logger.Error("stream %s: %v", s.name, err)
+			return res, err
+		}
+	}
+	for i, db := range cfg.Databases {
+		name := "db-" + db.Name + ".sql"
+		if progress != nil {
+			progress(len(sources)+i+1, total, name)
+		}
+		n, err := streamDump(ctx, tw, db, name, m)
+		res.Bytes += n
+		if err != nil {
+			logger.Error("%v", err)
+			return res, err
+		}
+		logger.Info("dumped %s (%s)", db.Name, humanSize(n))
+	}
+	if err := tw.Close(); err != nil {
+		return res, err
+	}
+	res.SHA256 = hex.EncodeToString(h.Sum(nil))
+	logger.Info("stream backup done id=%s size=%s sha256=%s", id, humanSize(res.Bytes), res.SHA256)
+
+	m.StreamSHA256 = res.SHA256
+	m.Finished = time.Now()
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	res.Manifest = filepath.Join(cfg.BackupPath, "logs", "stream-"+now.Format("20060102-1504")+".manifest.json.gz")
+	err = os.MkdirAll(filepath.Dir(res.Manifest), 0o755)
+	if err == nil {
+		err = saveManifestAs(res.Manifest, m)
+	}
+	if err != nil {
+		// The stream itself is complete; only its local record is missing.
+		logger.Error("stream manifest %s: %v", res.Manifest, err)
+		res.Manifest = ""
+	}
+	return res, nil
+}
+
+// streamDump runs the dump of db into a temporary file and adds it to tw
+// as name. The temporary file lives outside backup_path and is removed.
+func streamDump(ctx context.Context, tw *tarZst, db config.Database, name string, m *Manifest) (int64, error) {
+	scratch, err := os.MkdirTemp("", "lifeboat-dump-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(scratch)
+	file := filepath.Join(scratch, name)
+	if err := runDump(ctx, db, file); err != nil {
+		return 0, err
+	}
+	return writeTree(ctx, tw, file, name, m.recorder(name), nil, true)
+}
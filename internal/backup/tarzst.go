@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// tarZst is a tar stream over zstd. Files with one of the store
+// extensions (.jar, .war, .zip: compressed already) go into zstd frames of
+// their own written at the fastest level, which stores them at almost no
+// cost; everything else gets the normal encoder. Readers see one ordinary
+// zstd stream, since concatenated frames decode as one.
+type tarZst struct {
+	*tar.Writer
+	out             io.Writer
+	main, fast, cur *zstd.Encoder
+	store           []string
+}
+
+func newTarZst(w io.Writer, store []string) (*tarZst, error) {
+	main, err := newZstdWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	t := &tarZst{out: w, main: main, cur: main, store: store}
+	t.Writer = tar.NewWriter(encoderWriter{t})
+	return t, nil
+}
+
+// encoderWriter sends the tar stream to whichever encoder is current.
+type encoderWriter struct{ t *tarZst }
+
+func (w encoderWriter) Write(p []byte) (int, error) { return w.t.cur.Write(p) }
+
+// use picks the encoder for the file name, ending the current frame when
+// that changes. Call it before the file's header is written.
+func (t *tarZst) use(name string) error {
+	want := t.main
+	if storeExt(t.store, name) {
+		if t.fast == nil {
+			fast, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return err
+			}
+			t.fast = fast
+		}
+		want = t.fast
+	}
+	if want == t.cur {
+		return nil
+	}
+	if err := t.cur.Close(); err != nil {
+		return err
+	}
+	want.Reset(t.out)
+	t.cur = want
+	return nil
+}
+
+// Close ends the tar stream and the last zstd frame. zstd buffers, so a
+// full disk often only shows up here.
+func (t *tarZst) Close() error {
+	if err := t.Writer.Close(); err != nil {
+		return err
+	}
+	return t.cur.Close()
+}
+
+// storeExt reports whether name ends in one of exts, written with or
+// without the dot.
+func storeExt(exts []string, name string) bool {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return false
+	}
+	for _, e := range exts {
+		if strings.EqualFold(e, ext) || strings.EqualFold("."+e, ext) {
+			return true
+		}
+	}
+	return false
+}
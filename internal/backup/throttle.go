@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// throttle caps how fast backup and replica copies read source data so a
+// backup during business hours does not saturate disk IO. Zero = no limit.
+var throttle struct {
+	sync.Mutex
+	bytesPerSec float64
+	due         time.Time // when the bytes read so far are paid for
+}
+
+// throttleBurst is the most idle time that counts as credit, so time spent
+// in the menu or between copies cannot turn into an unthrottled burst.
+const throttleBurst = time.Second
+
+// SetThrottle limits copy throughput to mbPerSec megabytes per second
+// (0 = unlimited). It applies to every copy made by this process.
+func SetThrottle(mbPerSec float64) {
+	throttle.Lock()
+	defer throttle.Unlock()
+	throttle.bytesPerSec = mbPerSec * (1 << 20)
+	throttle.due = time.Time{}
+}
+
+// throttleWait accounts for n bytes just read and sleeps long enough to
+// keep the rate under the limit, allowing at most throttleBurst ahead.
+func throttleWait(ctx context.Context, n int) {
+	throttle.Lock()
+	if throttle.bytesPerSec <= 0 {
+		throttle.Unlock()
+		return
+	}
+	if earliest := time.Now().Add(-throttleBurst); throttle.due.Before(earliest) {
+		throttle.due = earliest
+	}
+	throttle.due = throttle.due.Add(time.Duration(float64(n) / throttle.bytesPerSec * float64(time.Second)))
+	due := throttle.due
+	throttle.Unlock()
+
+	if d := time.Until(due); d > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(d):
+		}
+	}
+}
@@ -3,8 +3,11 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -42,14 +45,256 @@ func Load(path string) (*Config, error) {
 	} else if !filepath.IsAbs(cfg.BackupPath) {
 		cfg.BackupPath = filepath.Join(dir, cfg.BackupPath)
 	}
+	if _, err := cfg.BudgetBytes(); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	switch cfg.Confirmation {
+	case "strict", "normal", "off":
+	default:
+		return nil, fmt.Errorf("parse %s: confirmation must be strict, normal or off, got %q", path, cfg.Confirmation)
+	}
+	if _, err := cfg.LogMaxBytes(); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.LogMaxFiles < 0 {
+		return nil, fmt.Errorf("parse %s: log_max_files must be 0 or more", path)
+	}
+	if strings.TrimSpace(cfg.HealthMinFree) != "" {
+		if _, err := ParseSize(cfg.HealthMinFree); err != nil {
+			return nil, fmt.Errorf("parse %s: health_min_free: %w", path, err)
+		}
+	}
+	if cfg.RetryCount < 0 || cfg.RetryDelayMinutes < 0 {
+		return nil, fmt.Errorf("parse %s: retry_count and retry_delay_minutes must be 0 or more", path)
+	}
+	if cfg.CompressionThreads < 0 {
+		return nil, fmt.Errorf("parse %s: compression_threads must be 0 (all cores) or more", path)
+	}
+	if cfg.StopTomcat && strings.TrimSpace(cfg.TomcatService) == "" {
+		return nil, fmt.Errorf("parse %s: stop_tomcat needs tomcat_service", path)
+	}
+	if cfg.ReplicaPath != "" && !filepath.IsAbs(cfg.ReplicaPath) {
+		cfg.ReplicaPath = filepath.Join(dir, cfg.ReplicaPath)
+	}
 	cfg.WebappsPath = normalize(cfg.WebappsPath)
 	cfg.BackupPath = normalize(cfg.BackupPath)
+	cfg.ReplicaPath = normalize(cfg.ReplicaPath)
+	if cfg.CatalogPath != "" && !filepath.IsAbs(cfg.CatalogPath) {
+		cfg.CatalogPath = filepath.Join(dir, cfg.CatalogPath)
+	}
+	cfg.CatalogPath = normalize(cfg.CatalogPath)
 	for i, f := range cfg.ExtraFolders {
 		cfg.ExtraFolders[i] = normalize(f)
 	}
+	dbs := map[string]bool{}
+	for _, db := range cfg.Databases {
+		if strings.TrimSpace(db.Name) == "" || len(db.Command) == 0 {
+			return nil, fmt.Errorf("parse %s: every [[databases]] entry needs a name and a command", path)
+		}
+		if strings.ContainsAny(db.Name, `/\`) {
+			return nil, fmt.Errorf("parse %s: database name %q must not contain slashes", path, db.Name)
+		}
+		if dbs[db.Name] {
+			return nil, fmt.Errorf("parse %s: database %q is listed twice", path, db.Name)
+		}
+		dbs[db.Name] = true
+	}
+	if err := checkPatterns("exclude", cfg.Exclude); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := checkPatterns("webapp_excludes", cfg.WebappExcludes); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	webapps := map[string]bool{}
+	for _, w := range cfg.Webapps {
+		if strings.TrimSpace(w.Name) == "" {
+			return nil, fmt.Errorf("parse %s: every [[webapps]] entry needs a name", path)
+		}
+		if webapps[w.Name] {
+			return nil, fmt.Errorf("parse %s: webapp %q is listed twice", path, w.Name)
+		}
+		webapps[w.Name] = true
+		if err := checkPatterns(w.Name+" include", w.Include); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if err := checkPatterns(w.Name+" exclude", w.Exclude); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	seen := map[string]bool{}
+	for i := range cfg.Instances {
+		in := &cfg.Instances[i]
+		if strings.TrimSpace(in.Name) == "" {
+			return nil, fmt.Errorf("parse %s: every [[instances]] entry needs a name", path)
+		}
+		if seen[in.Name] {
+			return nil, fmt.Errorf("parse %s: instance %q is listed twice", path, in.Name)
+		}
+		seen[in.Name] = true
+		if in.BackupPath != "" && !filepath.IsAbs(in.BackupPath) {
+			in.BackupPath = filepath.Join(dir, in.BackupPath)
+		}
+		in.WebappsPath = normalize(in.WebappsPath)
+		in.BackupPath = normalize(in.BackupPath)
+		for j, f := range in.ExtraFolders {
+			in.ExtraFolders[j] = normalize(f)
+		}
+	}
 	return cfg, nil
 }
 
+// checkPatterns rejects glob patterns path.Match cannot parse.
+func checkPatterns(key string, patterns []string) error {
+	for _, p := range patterns {
+		if strings.Trim(p, "/") == "" {
+			return fmt.Errorf("%s: empty pattern", key)
+		}
+		for _, part := range strings.Split(p, "/") {
+			if _, err := pathpkg.Match(part, ""); err != nil {
+				return fmt.Errorf("%s: bad pattern %q", key, p)
+			}
+		}
+	}
+	return nil
+}
+
+// ForInstance returns a copy of c with the named instance's settings
+// applied on top.
+func (c *Config) ForInstance(name string) (*Config, error) {
+	for _, in := range c.Instances {
+		if in.Name != name {
+			continue
+		}
+		out := *c
+		out.Instances = nil
+		out.Name = in.Name
+		if in.WebappsPath != "" {
+			out.WebappsPath = in.WebappsPath
+		}
+		if in.BackupPath != "" {
+			out.BackupPath = in.BackupPath
+		}
+		if in.ExtraFolders != nil {
+			out.ExtraFolders = in.ExtraFolders
+		}
+		if in.TomcatService != "" {
+			out.TomcatService = in.TomcatService
+		}
+		return &out, nil
+	}
+	names := make([]string, len(c.Instances))
+	for i, in := range c.Instances {
+		names[i] = in.Name
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no [[instances]] in the config, so there is no instance %q", name)
+	}
+	return nil, fmt.Errorf("unknown instance %q (have: %s)", name, strings.Join(names, ", "))
+}
+
+// Snapshot renders the effective settings as TOML for storing with a
+// backup. Other instances are left out and passwords given on database or
+// note command lines are masked.
+func (c *Config) Snapshot() (string, error) {
+	out := *c
+	out.Instances = nil
+	out.Databases = make([]Database, len(c.Databases))
+	for i, db := range c.Databases {
+		out.Databases[i] = Database{Name: db.Name, Command: redact(db.Command)}
+	}
+	out.NoteCommand = redact(c.NoteCommand)
+	var b strings.Builder
+	if err := toml.NewEncoder(&b).Encode(out); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// redact masks the usual ways of putting a password on a command line:
+// --password=x, -px (mysqldump), the argument after -p/--password, and
+// user:pass@ in connection URLs.
+func redact(args []string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i, a := range out {
+		lower := strings.ToLower(a)
+		switch {
+		case (lower == "-p" || lower == "--password") && i+1 < len(out):
+			out[i+1] = "***"
+		case strings.HasPrefix(lower, "--password="):
+			out[i] = a[:len("--password=")] + "***"
+		case strings.HasPrefix(a, "-p") && len(a) > 2:
+			out[i] = "-p***"
+		case strings.Contains(a, "://") && strings.Contains(a, "@"):
+			scheme, rest, _ := strings.Cut(a, "://")
+			if cred, host, ok := strings.Cut(rest, "@"); ok && strings.Contains(cred, ":") {
+				user, _, _ := strings.Cut(cred, ":")
+				out[i] = scheme + "://" + user + ":***@" + host
+			}
+		}
+	}
+	return out
+}
+
+// BudgetBytes returns Budget in bytes, or 0 when no budget is set.
+func (c *Config) BudgetBytes() (int64, error) {
+	if strings.TrimSpace(c.Budget) == "" {
+		return 0, nil
+	}
+	n, err := ParseSize(c.Budget)
+	if err != nil {
+		return 0, fmt.Errorf("budget: %w", err)
+	}
+	return n, nil
+}
+
+// LogMaxBytes returns LogMaxSize in bytes, or 0 when the log never rotates.
+func (c *Config) LogMaxBytes() (int64, error) {
+	if strings.TrimSpace(c.LogMaxSize) == "" {
+		return 0, nil
+	}
+	n, err := ParseSize(c.LogMaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("log_max_size: %w", err)
+	}
+	return n, nil
+}
+
+// IDPrefixExpanded returns IDPrefix with {hostname} filled in.
+func (c *Config) IDPrefixExpanded() string {
+	if !strings.Contains(c.IDPrefix, "{hostname}") {
+		return c.IDPrefix
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return strings.ReplaceAll(c.IDPrefix, "{hostname}", strings.ToLower(host))
+}
+
+// ParseSize turns "500GB", "1.5 TB" or "750mb" into bytes (1 KB = 1024 B).
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+	for _, u := range units {
+		if !strings.HasSuffix(t, u.suffix) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(t, u.suffix)), 64)
+		// ParseFloat takes "inf" and "NaN", which no comparison handles.
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 || v*u.mult >= math.MaxInt64 {
+			return 0, fmt.Errorf("invalid size %q", s)
+		}
+		return int64(v * u.mult), nil
+	}
+	return 0, fmt.Errorf("invalid size %q (use e.g. 500GB)", s)
+}
+
 // normalize converts mixed separators to OS-native ones.
 func normalize(p string) string {
 	if p == "" {
@@ -62,6 +307,32 @@ func normalize(p string) string {
 
 // Example returns the commented TOML template written by `config init`.
 func Example(name, webappsPath string) string {
+	return Starter{
+		Name:          name,
+		WebappsPath:   webappsPath,
+		BackupPath:    ".",
+		Compression:   defaultCompression(),
+		RetentionDays: 30,
+	}.TOML()
+}
+
+// Starter holds the answers `lifeboat wizard` collects; everything else in
+// the generated file keeps its default.
+type Starter struct {
+	Name          string
+	WebappsPath   string
+	BackupPath    string
+	Compression   bool
+	RetentionDays int
+	ExtraFolders  []string
+}
+
+// TOML renders the commented template with s filled in.
+func (s Starter) TOML() string {
+	extra := make([]string, len(s.ExtraFolders))
+	for i, f := range s.ExtraFolders {
+		extra[i] = fmt.Sprintf("%q", filepath.ToSlash(f))
+	}
 	return fmt.Sprintf(`# TTS Lifeboat configuration
 # Place this file as lifeboat.toml next to lifeboat.exe.
 
@@ -71,19 +342,177 @@ name = "%s"
 webapps_path = "%s"
 
 # Where backups are written. "." = same folder as this file.
-backup_path = "."
+backup_path = "%s"
 
 # true  = compress each item into a .tar.zst archive
 # false = plain folder copy (fastest, no compression)
 compression = %t
 
+# With compression on, entries of webapps_path with these extensions are
+# copied as they are instead of into a .tar.zst: they are compressed
+# already, so zstd would only cost time. Such files inside a webapp folder
+# (WEB-INF/lib/*.jar) stay in its archive but are only stored, not
+# compressed.
+store_extensions = [".war", ".jar", ".zip"]
+
+# Left out of everything backed up: webapps, extra_folders and the Tomcat
+# configuration. Patterns are relative to each webapp or folder; "name/"
+# matches folders only, a pattern without "/" matches at any depth and **
+# spans folders, e.g. exclude = ["*.tmp", "cache/", "**/node_modules/"].
+exclude = []
+
+# Left out of every webapp folder only, on top of exclude: Tomcat's scratch
+# folders, log files and desktop litter. Same pattern rules, e.g.
+# "WEB-INF/classes/**/*.class". [] = copy everything.
+webapp_excludes = ["work/", "temp/", "logs/", "*.log", ".DS_Store", "Thumbs.db"]
+
+# CPU cores zstd may use when compressing. 0 = all of them; lower it to
+# leave cores for Tomcat on a busy server.
+compression_threads = 0
+
 # Auto-delete backups older than this many days (0 = never delete).
-retention_days = 30
+retention_days = %d
+
+# Grandfather-father-son rotation instead of retention_days: keep the newest
+# backup of each of the last N days, weeks and months. All 0 = use
+# retention_days.
+keep_daily = 0
+keep_weekly = 0
+keep_monthly = 0
+
+# Delete expired backups right after every successful backup, without
+# asking, so disk use stays bounded without a scheduled cleanup job.
+auto_cleanup = false
 
 # Optional extra folders to back up alongside webapps (e.g. Tomcat conf).
 # Leave empty to skip.
-extra_folders = []
+extra_folders = [%s]
 # Example:
 # extra_folders = ["C:/TTS/MyApp/Tomcat/conf"]
-`, name, webappsPath, defaultCompression())
+
+# Also back up the Tomcat configuration next to webapps_path: all of conf/,
+# jars added to lib/ (not the ones Tomcat ships) and bin/setenv.*.
+# Stored as tomcat-conf, tomcat-lib and tomcat-bin. Also: lifeboat --with-conf
+include_tomcat_conf = false
+
+# Windows: read everything from a Volume Shadow Copy taken when the backup
+# starts, so files Tomcat keeps open (HSQLDB, Lucene indexes) are copied as
+# one consistent moment. lifeboat must run elevated (as Administrator);
+# where no snapshot can be taken the files are read live and it is logged.
+use_vss = false
+
+# Ask for an operator name/ID before deleting backups (useful on shared admin
+# accounts). Can also be passed up front: lifeboat --operator jdoe
+require_operator = false
+
+# Viewer mode: history only, no new backups and no cleanup.
+# Can also be forced with: lifeboat --read-only
+read_only = false
+
+# Space this environment's backups may use on a shared drive, e.g. "500GB".
+# History shows utilisation; exceeding it logs a warning. Empty = no budget.
+budget = ""
+# true = treat budget as a hard quota: refuse new backups while it is full,
+# so one instance can't crowd out others sharing the drive.
+enforce_budget = false
+
+# Stop Tomcat while the backup runs and start it again afterwards (also
+# when the backup fails). tomcat_service is the service name (e.g. "Tomcat9")
+# or the path to catalina.bat / catalina.sh. Also: lifeboat --stop-tomcat
+tomcat_service = ""
+stop_tomcat = false
+tomcat_timeout_seconds = 120
+
+# Copy every completed backup to a second location as well, e.g. a network
+# share. Same YYYYMMDD/HHMM layout. Empty = no second copy.
+replica_path = ""
+
+# Shared catalog of every server's backups (metadata only, no data), e.g.
+# "//nas/lifeboat/catalog.json". lifeboat catalog push adds this instance,
+# lifeboat catalog list shows each instance's latest backup. Empty = none.
+catalog_path = ""
+
+# Show a desktop notification (Windows toast / Linux notify-send) when a
+# backup started from the menu finishes.
+desktop_notify = false
+
+# How deleting backups is confirmed: "strict" = type DELETE (or the backup
+# ID), "normal" = y/N, "off" = no prompt.
+confirmation = "normal"
+
+# Fail the backup if it runs longer than this many minutes in total, or
+# spends longer than this on a single webapp/folder; its partial folder is
+# removed. 0 = no limit.
+max_duration_minutes = 0
+max_item_minutes = 0
+
+# If backup_path is a network share that may be asleep or behind a VPN,
+# keep retrying for up to this many minutes before failing. 0 = fail at once.
+wait_for_backup_path_minutes = 0
+
+# Retry a failed lifeboat backup (the scheduled, non-menu one) this many
+# times, first after retry_delay_minutes, then twice as long each time up to
+# an hour. Only the last failure notifies. 0 = fail at once.
+retry_count = 0
+retry_delay_minutes = 5
+
+# lifeboat health (for Nagios/Zabbix) is critical when the newest backup is
+# older than this many hours, or backup_path has less than health_min_free
+# left (e.g. "20GB"; empty = not checked).
+health_max_age_hours = 26
+health_min_free = ""
+
+# Limit how fast lifeboat reads data, in MB per second, so backups during
+# business hours don't saturate disk IO. 0 = unlimited.
+# Also: lifeboat --throttle 20
+max_mb_per_sec = 0
+
+# Prefix for backup IDs so they stay unique across a fleet, e.g. "{hostname}-"
+# gives IDs like web01-20260421-2126. Commands accept IDs with or without it.
+id_prefix = ""
+
+# Trim lifeboat's own log (logs/lifeboat.log) to this many days whenever
+# cleanup runs. 0 = keep the whole log.
+log_retention_days = 0
+
+# Start a new log file once logs/lifeboat.log reaches this size, e.g. "10MB",
+# keeping log_max_files older ones (lifeboat.log.1 is the newest).
+# Empty = one file that only log_retention_days trims.
+log_max_size = ""
+log_max_files = 5
+
+# Command whose output is saved as a note with every backup, e.g. the
+# deployed revision. Shown by lifeboat manifest. Empty = no note.
+# note_command = ["git", "-C", "C:/TTS/MyApp/src", "rev-parse", "--short", "HEAD"]
+note_command = []
+
+# Keep [[webapps]], [[databases]] and [[instances]] at the end of the file:
+# every key after a [[...]] line belongs to that entry.
+
+# Patterns for a single webapp, on top of webapp_excludes. With include set,
+# only matching files of that webapp are copied.
+# [[webapps]]
+# name = "ROOT"
+# include = ["WEB-INF/**", "*.jsp"]
+# exclude = ["uploads/"]
+
+# Dump databases into every backup as db-<name>.sql (archived like the
+# folders when compression is on). command is run as is and must write the
+# dump to standard output. Keep passwords out of this file: set PGPASSWORD,
+# MYSQL_PWD, ... in the environment lifeboat runs in. A failed dump fails
+# the backup.
+# [[databases]]
+# name = "appdb"
+# command = ["pg_dump", "-h", "localhost", "-U", "app", "appdb"]
+
+# More Tomcats on the same host. Each [[instances]] entry inherits every
+# setting above and overrides name, webapps_path, backup_path, extra_folders
+# or tomcat_service. Pick one with lifeboat --instance tomcat-b, or run a
+# command for all of them with lifeboat --all-instances <command>.
+# [[instances]]
+# name = "tomcat-b"
+# webapps_path = "C:/TTS/OtherApp/Tomcat/webapps"
+# backup_path = "D:/Backups/tomcat-b"
+`, s.Name, filepath.ToSlash(s.WebappsPath), filepath.ToSlash(s.BackupPath),
+		s.Compression, s.RetentionDays, strings.Join(extra, ", "))
 }
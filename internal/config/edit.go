@@ -0,0 +1,120 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Update sets top-level keys in the TOML file at path and keeps every
+// other line, comments included. A key that is missing (or only commented
+// out) is added before the first [table]. The file is only replaced if the
+// result loads like any lifeboat.toml does.
+func Update(path string, values map[string]any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	end := len(lines)
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "[") {
+			end = i
+			break
+		}
+	}
+	if end == len(lines) && end > 0 && lines[end-1] == "" {
+		end--
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lit, err := tomlValue(values[k])
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		found := false
+		for i := 0; i < end; i++ {
+			name, rest, ok := strings.Cut(lines[i], "=")
+			if !ok || strings.TrimSpace(name) != k {
+				continue
+			}
+			// A multi-line array continues until its brackets balance.
+			last := i
+			depth, comment := scanValue(rest)
+			for depth > 0 && last+1 < end {
+				last++
+				var d int
+				d, comment = scanValue(lines[last])
+				depth += d
+			}
+			line := k + " = " + lit
+			if comment != "" {
+				line += "  " + comment
+			}
+			lines = append(lines[:i], append([]string{line}, lines[last+1:]...)...)
+			end -= last - i
+			found = true
+			break
+		}
+		if !found {
+			lines = append(lines[:end], append([]string{k + " = " + lit}, lines[end:]...)...)
+			end++
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		return err
+	}
+	if _, err := Load(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tomlValue formats v the way it appears after "key = ".
+func tomlValue(v any) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]any{"v": v}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(buf.String(), "v = ")), nil
+}
+
+// scanValue returns how many more brackets s opens than it closes, and its
+// trailing # comment, ignoring both inside quoted strings.
+func scanValue(s string) (depth int, comment string) {
+	var quote rune
+	escaped := false
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == '#':
+			return depth, strings.TrimSpace(s[i:])
+		}
+	}
+	return depth, ""
+}
@@ -7,6 +7,173 @@ type Config struct {
 	Compression   bool     `toml:"compression"`
 	RetentionDays int      `toml:"retention_days"`
 	ExtraFolders  []string `toml:"extra_folders"`
+
+	// CompressionThreads caps the cores zstd uses (0 = all of them).
+	CompressionThreads int `toml:"compression_threads"`
+
+	// StoreExtensions lists extensions (".war", ".jar", ".zip") of files
+	// that are compressed already: webapps_path entries are copied as they
+	// are even with compression on, and files inside an archive are only
+	// stored.
+	StoreExtensions []string `toml:"store_extensions"`
+
+	// Exclude lists glob patterns left out of everything copied: webapps,
+	// extra_folders and the Tomcat configuration.
+	Exclude []string `toml:"exclude"`
+
+	// WebappExcludes are left out of every webapp folder; by default the
+	// scratch files Tomcat and desktops leave behind. [] copies everything.
+	WebappExcludes []string `toml:"webapp_excludes"`
+
+	// Webapps narrows single webapps further, see Webapp.
+	Webapps []Webapp `toml:"webapps"`
+
+	// IncludeTomcatConf adds the Tomcat configuration next to webapps_path
+	// to every backup: conf/, custom jars in lib/ and bin/setenv.*.
+	// --with-conf forces it on.
+	IncludeTomcatConf bool `toml:"include_tomcat_conf"`
+
+	// Databases are dumped into every backup, after the folders.
+	Databases []Database `toml:"databases"`
+
+	// UseVSS makes Windows backups read from a Volume Shadow Copy taken
+	// at the start, so files Tomcat holds open are copied consistently.
+	// Needs an elevated lifeboat; without one the files are read live.
+	UseVSS bool `toml:"use_vss"`
+
+	// RequireOperator makes destructive actions ask for an operator name
+	// when --operator was not given on the command line.
+	RequireOperator bool `toml:"require_operator"`
+
+	// ReadOnly disables backup and cleanup so the binary can be handed to
+	// support staff who should only look. --read-only forces it on.
+	ReadOnly bool `toml:"read_only"`
+
+	// Budget caps the space this instance's backups should use, e.g.
+	// "500GB". Empty means no budget. Exceeding it only warns.
+	Budget string `toml:"budget"`
+	// EnforceBudget turns the budget into a quota: no new backup starts
+	// while the existing ones already fill it.
+	EnforceBudget bool `toml:"enforce_budget"`
+
+	// TomcatService is the Windows/systemd service name or the path to
+	// catalina.sh/.bat. With StopTomcat set, Tomcat is stopped for the
+	// duration of a backup and started again afterwards.
+	TomcatService        string `toml:"tomcat_service"`
+	StopTomcat           bool   `toml:"stop_tomcat"`
+	TomcatTimeoutSeconds int    `toml:"tomcat_timeout_seconds"`
+
+	// ReplicaPath receives a second copy of every completed backup,
+	// e.g. a network share. Empty disables replication.
+	ReplicaPath string `toml:"replica_path"`
+
+	// CatalogPath is a JSON file, usually on a shared drive, that
+	// lifeboat catalog push/pull/list use to see backups across servers.
+	CatalogPath string `toml:"catalog_path"`
+
+	// DesktopNotify pops up a desktop notification when an interactive
+	// backup finishes.
+	DesktopNotify bool `toml:"desktop_notify"`
+
+	// Confirmation sets how destructive actions are confirmed:
+	// "strict" (type a phrase), "normal" (y/N) or "off" (no prompt).
+	Confirmation string `toml:"confirmation"`
+
+	// MaxDurationMinutes caps a whole backup run and MaxItemMinutes each
+	// webapp/folder in it, so a hung network share cannot keep a nightly
+	// job running for days. 0 = no limit.
+	MaxDurationMinutes int `toml:"max_duration_minutes"`
+	MaxItemMinutes     int `toml:"max_item_minutes"`
+
+	// RetryCount retries a failed lifeboat backup that many times, first
+	// after RetryDelayMinutes and then twice as long each time (at most an
+	// hour), before giving up.
+	RetryCount        int `toml:"retry_count"`
+	RetryDelayMinutes int `toml:"retry_delay_minutes"`
+
+	// HealthMaxAgeHours and HealthMinFree are the limits lifeboat health
+	// checks: the newest backup's age and the free space on backup_path
+	// (e.g. "20GB", empty = not checked).
+	HealthMaxAgeHours int    `toml:"health_max_age_hours"`
+	HealthMinFree     string `toml:"health_min_free"`
+
+	// WaitMinutes is how long a backup waits for backup_path to become
+	// reachable (a NAS waking up, a VPN connecting) before failing.
+	WaitMinutes int `toml:"wait_for_backup_path_minutes"`
+
+	// KeepDaily, KeepWeekly and KeepMonthly switch retention to
+	// grandfather-father-son rotation, replacing RetentionDays.
+	KeepDaily   int `toml:"keep_daily"`
+	KeepWeekly  int `toml:"keep_weekly"`
+	KeepMonthly int `toml:"keep_monthly"`
+
+	// AutoCleanup deletes expired backups after every successful backup,
+	// without asking, so no separate cleanup job is needed.
+	AutoCleanup bool `toml:"auto_cleanup"`
+
+	// MaxMBPerSec throttles copy throughput (0 = unlimited).
+	MaxMBPerSec float64 `toml:"max_mb_per_sec"`
+
+	// IDPrefix is put in front of every backup ID so IDs stay unique when
+	// backups from many servers are looked at together. "{hostname}" is
+	// replaced with this machine's name.
+	IDPrefix string `toml:"id_prefix"`
+
+	// NoteCommand runs at the start of every backup; its output is stored
+	// as the backup's note, e.g. ["git", "-C", "/opt/app", "rev-parse",
+	// "--short", "HEAD"] records the deployed revision.
+	NoteCommand []string `toml:"note_command"`
+
+	// LogRetentionDays trims logs/lifeboat.log to this many days on every
+	// cleanup. 0 = keep the whole log.
+	LogRetentionDays int `toml:"log_retention_days"`
+
+	// LogMaxSize rotates logs/lifeboat.log once it reaches this size, e.g.
+	// "10MB", keeping LogMaxFiles older copies. Empty = never rotate.
+	LogMaxSize  string `toml:"log_max_size"`
+	LogMaxFiles int    `toml:"log_max_files"`
+
+	// Instances describes further Tomcats on the same host. Each inherits
+	// every setting above and overrides only what it sets; --instance picks
+	// one, --all-instances runs a command for each.
+	Instances []Instance `toml:"instances"`
+}
+
+// Database is one [[databases]] entry. Command is run as is and its
+// standard output is the dump, e.g. ["pg_dump", "-U", "app", "appdb"].
+// Credentials come from the environment (PGPASSWORD, MYSQL_PWD, ...), not
+// from this file.
+type Database struct {
+	Name    string   `toml:"name"`
+	Command []string `toml:"command"`
+}
+
+// Webapp is one [[webapps]] entry: patterns for the webapps_path entry
+// called Name, applied on top of WebappExcludes. With Include set only
+// matching files are copied.
+type Webapp struct {
+	Name    string   `toml:"name"`
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+}
+
+// Instance is one [[instances]] entry.
+type Instance struct {
+	Name          string   `toml:"name"`
+	WebappsPath   string   `toml:"webapps_path"`
+	BackupPath    string   `toml:"backup_path"`
+	ExtraFolders  []string `toml:"extra_folders"`
+	TomcatService string   `toml:"tomcat_service"`
+}
+
+// GFS reports whether grandfather-father-son retention is configured.
+func (c *Config) GFS() bool {
+	return c.KeepDaily > 0 || c.KeepWeekly > 0 || c.KeepMonthly > 0
+}
+
+// CleanupEnabled reports whether any retention rule can delete backups.
+func (c *Config) CleanupEnabled() bool {
+	return c.RetentionDays > 0 || c.GFS()
 }
 
 func Default() *Config {
@@ -17,5 +184,14 @@ func Default() *Config {
 		Compression:   defaultCompression(),
 		RetentionDays: 30,
 		ExtraFolders:  []string{},
+		WebappExcludes: []string{
+			"work/", "temp/", "logs/", "*.log", ".DS_Store", "Thumbs.db",
+		},
+
+		TomcatTimeoutSeconds: 120,
+		LogMaxFiles:          5,
+		RetryDelayMinutes:    5,
+		HealthMaxAgeHours:    26,
+		Confirmation:         "normal",
 	}
 }
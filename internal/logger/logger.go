@@ -3,14 +3,31 @@
 package logger
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
-var fileWriter io.WriteCloser
+const stampLayout = "2006-01-02 15:04:05"
+
+var (
+	fileWriter io.WriteCloser
+	filePath   string
+	errorCount int
+
+	// Rotation: once the file reaches maxBytes it becomes lifeboat.log.1
+	// and older copies shift up, keeping maxFiles of them.
+	maxBytes int64
+	maxFiles int
+	written  int64
+)
 
 // Init opens logs/lifeboat.log under backupDir. Safe to call multiple times;
 // it replaces the previous writer.
@@ -19,19 +36,169 @@ func Init(backupDir string) error {
 		_ = fileWriter.Close()
 		fileWriter = nil
 	}
-	dir := filepath.Join(backupDir, "logs")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	path := Path(backupDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
-	f, err := os.OpenFile(filepath.Join(dir, "lifeboat.log"),
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
 	}
 	fileWriter = f
+	filePath = path
+	written = 0
+	if fi, err := f.Stat(); err == nil {
+		written = fi.Size()
+	}
 	return nil
 }
 
+// SetRotation rotates the log once it grows past maxSize bytes, keeping
+// keep older files as lifeboat.log.1 (newest) to lifeboat.log.<keep>.
+// maxSize 0 turns rotation off.
+func SetRotation(maxSize int64, keep int) {
+	maxBytes, maxFiles = maxSize, keep
+}
+
+// Files returns the log files of backupDir oldest first: the rotated
+// copies, then lifeboat.log itself. Files that do not exist are left out.
+func Files(backupDir string) []string {
+	cur := Path(backupDir)
+	var out []string
+	for _, n := range rotated(cur) {
+		out = append(out, fmt.Sprintf("%s.%d", cur, n))
+	}
+	if _, err := os.Stat(cur); err == nil {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// rotated returns the numbers of the rotated copies of path, highest
+// (oldest) first.
+func rotated(path string) []int {
+	matches, _ := filepath.Glob(path + ".*")
+	var nums []int
+	for _, m := range matches {
+		if n, err := strconv.Atoi(strings.TrimPrefix(m, path+".")); err == nil && n > 0 {
+			nums = append(nums, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(nums)))
+	return nums
+}
+
+// rotate moves the full log aside and opens a fresh one. Copies beyond
+// maxFiles are deleted.
+func rotate() {
+	_ = fileWriter.Close()
+	fileWriter = nil
+	for _, n := range rotated(filePath) {
+		old := fmt.Sprintf("%s.%d", filePath, n)
+		if n >= maxFiles {
+			_ = os.Remove(old)
+			continue
+		}
+		_ = os.Rename(old, fmt.Sprintf("%s.%d", filePath, n+1))
+	}
+	if maxFiles > 0 {
+		_ = os.Rename(filePath, filePath+".1")
+	} else {
+		_ = os.Remove(filePath)
+	}
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: could not reopen log file:", err)
+		return
+	}
+	fileWriter = f
+	written = 0
+}
+
+// Path returns the log file used for backupDir.
+func Path(backupDir string) string {
+	return filepath.Join(backupDir, "logs", "lifeboat.log")
+}
+
+// ParseLine splits a log line into its time, level and message.
+func ParseLine(line string) (t time.Time, level, msg string, ok bool) {
+	if len(line) < len(stampLayout)+3 {
+		return t, "", "", false
+	}
+	t, err := time.ParseInLocation(stampLayout, line[:len(stampLayout)], time.Local)
+	if err != nil {
+		return t, "", "", false
+	}
+	rest := line[len(stampLayout)+1:]
+	end := strings.Index(rest, "] ")
+	if !strings.HasPrefix(rest, "[") || end < 0 {
+		return t, "", "", false
+	}
+	return t, rest[1:end], rest[end+2:], true
+}
+
+// Prune drops the lines older than days from the open log file and returns
+// how many were removed. Lines are appended in time order, so everything
+// before the first recent-enough timestamp goes. Rotated copies whose last
+// line is older than that are deleted whole.
+func Prune(days int) (int, error) {
+	if fileWriter == nil || days <= 0 {
+		return 0, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	for _, n := range rotated(filePath) {
+		old := fmt.Sprintf("%s.%d", filePath, n)
+		if fi, err := os.Stat(old); err == nil && fi.ModTime().Before(cutoff) {
+			_ = os.Remove(old)
+		}
+	}
+	removed, offset := 0, 0
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), len(data)+1)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) >= len(stampLayout) {
+			t, err := time.ParseInLocation(stampLayout, string(line[:len(stampLayout)]), time.Local)
+			if err == nil && !t.Before(cutoff) {
+				break
+			}
+		}
+		removed++
+		offset += len(line) + 1
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	_ = fileWriter.Close()
+	fileWriter = nil
+	tmp := filePath + ".tmp"
+	werr := os.WriteFile(tmp, data[offset:], 0o644)
+	if werr == nil {
+		werr = os.Rename(tmp, filePath)
+	}
+	if werr != nil {
+		_ = os.Remove(tmp)
+	}
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	fileWriter = f
+	if werr != nil {
+		return 0, werr
+	}
+	written = int64(len(data) - offset)
+	return removed, nil
+}
+
 // Close flushes and closes the log file.
 func Close() {
 	if fileWriter != nil {
@@ -42,10 +209,18 @@ func Close() {
 
 func write(level, msg string) {
 	line := fmt.Sprintf("%s [%s] %s\n",
-		time.Now().Format("2006-01-02 15:04:05"), level, msg)
-	if fileWriter != nil {
-		_, _ = fileWriter.Write([]byte(line))
+		time.Now().Format(stampLayout), level, msg)
+	if fileWriter == nil {
+		return
 	}
+	if maxBytes > 0 && written > 0 && written+int64(len(line)) > maxBytes {
+		rotate()
+		if fileWriter == nil {
+			return
+		}
+	}
+	n, _ := fileWriter.Write([]byte(line))
+	written += int64(n)
 }
 
 // Info writes an INFO line to the log file only (terminal stays clean).
@@ -56,6 +231,13 @@ func Info(format string, a ...any) {
 // Error writes an ERROR line to both file and stderr.
 func Error(format string, a ...any) {
 	msg := fmt.Sprintf(format, a...)
+	errorCount++
 	write("ERROR", msg)
 	fmt.Fprintln(os.Stderr, "ERROR:", msg)
 }
+
+// Errors returns how many ERROR lines were written since the process
+// started. A run that succeeded but logged errors finished with warnings.
+func Errors() int {
+	return errorCount
+}
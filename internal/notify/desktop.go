@@ -0,0 +1,44 @@
+// Package notify pops up a desktop notification when a long interactive
+// run finishes, for operators who switched to another window.
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Desktop shows a toast on Windows or a libnotify bubble on Linux desktops.
+// It is best-effort: servers without a desktop simply return an error.
+func Desktop(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript(title, message))
+	case "linux":
+		cmd = exec.Command("notify-send", "--app-name=lifeboat", title, message)
+	default:
+		return fmt.Errorf("desktop notifications not supported on %s", runtime.GOOS)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(strings.TrimSpace(string(out))) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+// toastScript builds a PowerShell snippet that raises a Windows 10+ toast.
+func toastScript(title, message string) string {
+	esc := func(s string) string {
+		s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+		return strings.ReplaceAll(s, "'", "''")
+	}
+	return fmt.Sprintf(`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode('%s')) > $null
+$x.Item(1).AppendChild($t.CreateTextNode('%s')) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('TTS Lifeboat').Show([Windows.UI.Notifications.ToastNotification]::new($t))`,
+		esc(title), esc(message))
+}
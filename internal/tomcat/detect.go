@@ -0,0 +1,161 @@
+package tomcat
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Install is a Tomcat found on this machine.
+type Install struct {
+	Home    string `json:"home"`              // CATALINA_BASE / install folder
+	Webapps string `json:"webapps"`           // Home/webapps
+	Source  string `json:"source"`            // how it was found: "CATALINA_BASE", "service", "registry", "path"
+	Service string `json:"service,omitempty"` // Windows service name, when found through one
+}
+
+// Detect looks for Tomcat installs via CATALINA_BASE/CATALINA_HOME, the
+// Windows services and installer registry entries and the usual install
+// folders. Only folders that have a webapps directory are returned;
+// duplicates are dropped.
+func Detect() []Install {
+	var found []Install
+	seen := map[string]bool{}
+	add := func(home, source, service string) {
+		if home == "" {
+			return
+		}
+		home = filepath.Clean(home)
+		webapps := filepath.Join(home, "webapps")
+		if fi, err := os.Stat(webapps); err != nil || !fi.IsDir() {
+			return
+		}
+		key := webapps
+		if real, err := filepath.EvalSymlinks(webapps); err == nil {
+			key = real
+		}
+		if runtime.GOOS == "windows" {
+			key = strings.ToLower(key)
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		found = append(found, Install{Home: home, Webapps: webapps, Source: source, Service: service})
+	}
+
+	add(os.Getenv("CATALINA_BASE"), "CATALINA_BASE", "")
+	add(os.Getenv("CATALINA_HOME"), "CATALINA_HOME", "")
+	bases := serviceBases()
+	services := make([]string, 0, len(bases))
+	for svc := range bases {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+	for _, svc := range services {
+		add(bases[svc], "service", svc)
+	}
+	for _, home := range registryHomes() {
+		add(home, "registry", "")
+	}
+	for _, pattern := range commonPatterns() {
+		matches, _ := filepath.Glob(pattern)
+		sort.Strings(matches)
+		for _, m := range matches {
+			add(m, "path", "")
+		}
+	}
+	return found
+}
+
+func commonPatterns() []string {
+	if runtime.GOOS == "windows" {
+		return []string{
+			`C:\Program Files\Apache Software Foundation\Tomcat*`,
+			`C:\Program Files (x86)\Apache Software Foundation\Tomcat*`,
+			`C:\tomcat*`,
+			`C:\apache-tomcat*`,
+			`C:\TTS\*\Tomcat`,
+			`D:\TTS\*\Tomcat`,
+		}
+	}
+	return []string{
+		"/opt/tomcat*",
+		"/opt/apache-tomcat*",
+		"/opt/*/tomcat",
+		"/usr/local/tomcat*",
+		"/usr/local/apache-tomcat*",
+		"/usr/share/tomcat*",
+		"/var/lib/tomcat*",
+		"/srv/tomcat*",
+	}
+}
+
+// serviceBases maps each Tomcat Windows service to its catalina.base, read
+// from the -Dcatalina.base option procrun (tomcat9.exe) keeps in the
+// registry.
+func serviceBases() map[string]string {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	bases := map[string]string{}
+	for _, key := range []string{
+		`HKLM\SOFTWARE\Apache Software Foundation\Procrun 2.0`,
+		`HKLM\SOFTWARE\WOW6432Node\Apache Software Foundation\Procrun 2.0`,
+	} {
+		out, err := exec.Command("reg", "query", key, "/s", "/v", "Options").Output()
+		if err != nil {
+			continue
+		}
+		svc := ""
+		for _, line := range strings.Split(string(out), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "HKEY_") {
+				// ...\Procrun 2.0\<service>\Parameters\Java
+				parts := strings.Split(line, `\`)
+				if len(parts) >= 3 {
+					svc = parts[len(parts)-3]
+				}
+				continue
+			}
+			f := strings.SplitN(line, "REG_MULTI_SZ", 2)
+			if len(f) != 2 || svc == "" {
+				continue
+			}
+			for _, opt := range strings.Split(f[1], `\0`) {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(opt), "-Dcatalina.base="); ok {
+					bases[svc] = v
+				}
+			}
+		}
+	}
+	return bases
+}
+
+// registryHomes reads the InstallPath values the Tomcat Windows installer
+// writes. `reg` ships with every Windows version, like `sc`.
+func registryHomes() []string {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	var homes []string
+	for _, key := range []string{
+		`HKLM\SOFTWARE\Apache Software Foundation\Tomcat`,
+		`HKLM\SOFTWARE\WOW6432Node\Apache Software Foundation\Tomcat`,
+	} {
+		out, err := exec.Command("reg", "query", key, "/s", "/v", "InstallPath").Output()
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			f := strings.SplitN(strings.TrimSpace(line), "REG_SZ", 2)
+			if len(f) == 2 && strings.HasPrefix(strings.TrimSpace(f[0]), "InstallPath") {
+				homes = append(homes, strings.TrimSpace(f[1]))
+			}
+		}
+	}
+	return homes
+}
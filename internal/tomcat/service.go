@@ -0,0 +1,76 @@
+// Package tomcat stops and starts the Tomcat instance around a backup.
+package tomcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Stop stops Tomcat. target is either a service name ("Tomcat9") or the
+// path to catalina.sh / catalina.bat. It waits at most timeout.
+func Stop(target string, timeout time.Duration) error {
+	return control(target, "stop", timeout)
+}
+
+// Start starts Tomcat again. Same target rules as Stop.
+func Start(target string, timeout time.Duration) error {
+	return control(target, "start", timeout)
+}
+
+func control(target, action string, timeout time.Duration) error {
+	if strings.TrimSpace(target) == "" {
+		return errors.New("tomcat_service is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if isScript(target) {
+		return run(ctx, target, action)
+	}
+	if runtime.GOOS != "windows" {
+		return run(ctx, "systemctl", action, target)
+	}
+
+	// `sc` returns as soon as the request is queued, so poll until the
+	// service reports the state we asked for.
+	if err := run(ctx, "sc", action, target); err != nil {
+		return err
+	}
+	want := "RUNNING"
+	if action == "stop" {
+		want = "STOPPED"
+	}
+	for {
+		out, _ := exec.CommandContext(ctx, "sc", "query", target).CombinedOutput()
+		if strings.Contains(string(out), want) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s %s: service not %s after %s", action, target, strings.ToLower(want), timeout)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func isScript(target string) bool {
+	base := strings.ToLower(filepath.Base(target))
+	return strings.HasPrefix(base, "catalina.") || strings.ContainsAny(target, `/\`)
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s %s: timed out", name, strings.Join(args, " "))
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
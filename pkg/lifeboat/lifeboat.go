@@ -0,0 +1,103 @@
+// Package lifeboat is the public Go API of TTS Lifeboat for tools that want
+// to embed it instead of running the binary. It wraps the internal
+// config and backup packages; see those for details of each operation.
+//
+// Progress goes to logs/lifeboat.log only if the caller opens it with
+// InitLog; errors are always printed to stderr.
+package lifeboat
+
+import (
+	"context"
+
+	"github.com/kannan/tts-lifeboat/internal/backup"
+	"github.com/kannan/tts-lifeboat/internal/config"
+	"github.com/kannan/tts-lifeboat/internal/logger"
+)
+
+// Config is the parsed lifeboat.toml.
+type Config = config.Config
+
+// Item is one entry of webapps_path that can be backed up.
+type Item = backup.Item
+
+// Backup is one backup folder under backup_path.
+type Backup = backup.HistoryEntry
+
+// FileEntry is one file inside a backup.
+type FileEntry = backup.FileEntry
+
+// Manifest is the per-file listing stored with each backup.
+type Manifest = backup.Manifest
+
+// LoadConfig reads a lifeboat.toml ("" = lifeboat.toml in the working dir).
+func LoadConfig(path string) (*Config, error) { return config.Load(path) }
+
+// DefaultConfig returns the built-in defaults, for callers that build a
+// configuration in code.
+func DefaultConfig() *Config { return config.Default() }
+
+// InitLog opens logs/lifeboat.log under cfg.BackupPath, rotated as
+// log_max_size/log_max_files say. Call CloseLog when done.
+func InitLog(cfg *Config) error {
+	size, err := cfg.LogMaxBytes()
+	if err != nil {
+		return err
+	}
+	logger.SetRotation(size, cfg.LogMaxFiles)
+	return logger.Init(cfg.BackupPath)
+}
+
+// CloseLog closes the log file opened by InitLog.
+func CloseLog() { logger.Close() }
+
+// ListWebapps returns the entries of webapps_path, sorted by name.
+func ListWebapps(cfg *Config) ([]Item, error) { return backup.ListWebapps(cfg) }
+
+// Run backs up items plus extra_folders and returns the new backup's folder
+// and the bytes copied. progress may be nil. Like the lifeboat command it
+// refuses to start while another backup or cleanup holds backup_path.
+func Run(ctx context.Context, cfg *Config, items []Item, progress func(step, total int, name string)) (string, int64, error) {
+	release, err := backup.AcquireRunLock(cfg, "backup")
+	if err != nil {
+		return "", 0, err
+	}
+	defer release()
+	backup.SetThrottle(cfg.MaxMBPerSec)
+	backup.SetCompressionThreads(cfg.CompressionThreads)
+	return backup.Run(ctx, cfg, items, progress)
+}
+
+// WithNote returns a ctx that makes Run store note with the backup.
+func WithNote(ctx context.Context, note string) context.Context { return backup.WithNote(ctx, note) }
+
+// List returns all backups, newest first.
+func List(cfg *Config) ([]Backup, error) { return backup.History(cfg) }
+
+// Find resolves a backup ID such as "20260421-2126" or "latest".
+func Find(cfg *Config, id string) (Backup, error) { return backup.Find(cfg, id) }
+
+// ID returns the ID users see for b.
+func ID(cfg *Config, b Backup) string { return backup.ID(cfg, b) }
+
+// Files lists the files inside b without extracting anything.
+func Files(b Backup) ([]FileEntry, error) { return backup.List(b) }
+
+// ReadManifest loads the manifest stored with b.
+func ReadManifest(b Backup) (*Manifest, error) { return backup.ReadManifest(b) }
+
+// Verify re-reads b and checks it against its manifest, returning the
+// number of files checked.
+func Verify(b Backup) (int, error) { return backup.Verify(b) }
+
+// Cleanup deletes the backups the retention rules expire; with dryRun it
+// only reports them. Returns the affected backups and bytes freed.
+func Cleanup(cfg *Config, dryRun bool) ([]Backup, int64, error) {
+	if !dryRun {
+		release, err := backup.AcquireRunLock(cfg, "cleanup")
+		if err != nil {
+			return nil, 0, err
+		}
+		defer release()
+	}
+	return backup.Cleanup(cfg, dryRun)
+}